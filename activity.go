@@ -0,0 +1,454 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	"data-loader/models"
+)
+
+var (
+	churnRate = flag.Float64("churn", 0.05, "fraction of follows, blocks, restricts, comment likes and highlight stories that were undone or redone in the activity tables")
+	blockRate = flag.Float64("block-rate", 0.01, "fraction of users that block or restrict other users")
+
+	viewRate       = flag.Float64("view-rate", 0.3, "mean fraction of the followers of a user viewing each of their stories")
+	viewRateSpread = flag.Float64("view-rate-spread", 0.1, "standard deviation of the view rate between stories")
+	storyLikeRate  = flag.Float64("story-like-rate", 0.1, "fraction of story views that like the story")
+)
+
+// account is a user with the time it was created, the earliest time of
+// anything done by or to it.
+type account struct {
+	ID        string
+	CreatedAt time.Time
+}
+
+func loadAccounts(ctx context.Context) ([]account, error) {
+	users, err := loadTable[models.User](ctx, "users", "id")
+	if err != nil {
+		return nil, err
+	}
+	accounts := make([]account, len(users))
+	for i, user := range users {
+		accounts[i] = account{ID: user.ID, CreatedAt: user.CreatedAt}
+	}
+	return accounts, nil
+}
+
+func loadFollows(ctx context.Context) ([]models.Follower, error) {
+	return loadTable[models.Follower](ctx, "followers", "follower_id, following_id")
+}
+
+// followersOf groups follows by the followed account, ordered by follower.
+func followersOf(follows []models.Follower) map[string][]models.Follower {
+	followers := map[string][]models.Follower{}
+	for _, follow := range follows {
+		followers[follow.FollowingID] = append(followers[follow.FollowingID], follow)
+	}
+	return followers
+}
+
+func pairKey(a, b string) string {
+	return a + "_" + b
+}
+
+// undoneBefore draws an earlier do and undo of an action that happened at.
+func undoneBefore(rng *rand.Rand, at time.Time) (time.Time, time.Time) {
+	done := timeBefore(rng, at, *activityWindow)
+	return done, timeAfter(rng, done, at.Sub(done))
+}
+
+// since draws a time between start and the reference time.
+func since(rng *rand.Rand, start time.Time) time.Time {
+	return timeAfter(rng, start, clock().Sub(start))
+}
+
+// createFollowersActivity logs a follow for every row of followers, preceded
+// by a follow and unfollow for some of them, and adds follows that were
+// undone, so replaying the log gives the followers table.
+func createFollowersActivity(ctx context.Context, rng *rand.Rand) error {
+	accounts, err := loadAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+
+	activity, err := newBatchWriter[*models.FollowersActivity](ctx, "followers_activity")
+	if err != nil {
+		return err
+	}
+	add := func(follower, following string, isUnfollow bool, at time.Time) error {
+		return activity.Add(&models.FollowersActivity{
+			ID:          newUUID(rng),
+			FollowerID:  follower,
+			FollowingID: following,
+			IsUnfollow:  isUnfollow,
+			CreatedAt:   at,
+		})
+	}
+
+	createdAt := map[string]time.Time{}
+	for _, account := range accounts {
+		createdAt[account.ID] = account.CreatedAt
+	}
+
+	following := map[string]bool{}
+	for _, follow := range follows {
+		following[pairKey(follow.FollowerID, follow.FollowingID)] = true
+		if rng.Float64() < *churnRate {
+			// the earlier follow is still after both accounts were created
+			followed, unfollowed := undoneBefore(rng, follow.FollowedAt)
+			followed = latest(followed, latest(createdAt[follow.FollowerID], createdAt[follow.FollowingID]))
+			unfollowed = latest(unfollowed, followed)
+			if err := add(follow.FollowerID, follow.FollowingID, false, followed); err != nil {
+				return err
+			}
+			if err := add(follow.FollowerID, follow.FollowingID, true, unfollowed); err != nil {
+				return err
+			}
+		}
+		if err := add(follow.FollowerID, follow.FollowingID, false, follow.FollowedAt); err != nil {
+			return err
+		}
+	}
+
+	undone := int(float64(len(follows)) * *churnRate)
+	for i := 0; i < undone && len(accounts) > 1; i++ {
+		follower, followed := accounts[rng.Intn(len(accounts))], accounts[rng.Intn(len(accounts))]
+		key := pairKey(follower.ID, followed.ID)
+		if follower.ID == followed.ID || following[key] {
+			continue
+		}
+		following[key] = true
+		at := since(rng, latest(follower.CreatedAt, followed.CreatedAt))
+		if err := add(follower.ID, followed.ID, false, at); err != nil {
+			return err
+		}
+		if err := add(follower.ID, followed.ID, true, timeAfter(rng, at, *activityWindow)); err != nil {
+			return err
+		}
+	}
+
+	if err := activity.Close(); err != nil {
+		return err
+	}
+
+	log.Println("Followers activity created")
+	return nil
+}
+
+// createBlocks lets --block-rate of the users block up to three users they
+// have no follow relation with. block_activity logs every block, some of them
+// after an earlier block and unblock, and blocks that were lifted again.
+func createBlocks(ctx context.Context, rng *rand.Rand) error {
+	accounts, err := loadAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+	if len(accounts) < 2 {
+		return nil
+	}
+
+	related := map[string]bool{}
+	for _, follow := range follows {
+		related[pairKey(follow.FollowerID, follow.FollowingID)] = true
+		related[pairKey(follow.FollowingID, follow.FollowerID)] = true
+	}
+
+	blocks := []*models.Block{}
+	activity := []*models.BlockActivity{}
+	logBlock := func(user, blocked string, isBlock bool, at time.Time) {
+		activity = append(activity, &models.BlockActivity{UserID: user, BlockedID: blocked, IsBlock: isBlock, CreatedAt: at})
+	}
+
+	blockers := int(float64(len(accounts)) * *blockRate)
+	for i := 0; i < blockers; i++ {
+		user := accounts[rng.Intn(len(accounts))]
+		for n := rng.Intn(3) + 1; n > 0; n-- {
+			blocked := accounts[rng.Intn(len(accounts))]
+			key := pairKey(user.ID, blocked.ID)
+			if user.ID == blocked.ID || related[key] {
+				continue
+			}
+			related[key] = true
+
+			at := since(rng, latest(user.CreatedAt, blocked.CreatedAt))
+			if rng.Float64() < *churnRate {
+				// blocks that were lifted and not renewed are only in the log
+				logBlock(user.ID, blocked.ID, true, at)
+				logBlock(user.ID, blocked.ID, false, timeAfter(rng, at, *activityWindow))
+				continue
+			}
+			if rng.Float64() < *churnRate {
+				blockedAt, unblockedAt := undoneBefore(rng, at)
+				blockedAt = latest(blockedAt, latest(user.CreatedAt, blocked.CreatedAt))
+				unblockedAt = latest(unblockedAt, blockedAt)
+				logBlock(user.ID, blocked.ID, true, blockedAt)
+				logBlock(user.ID, blocked.ID, false, unblockedAt)
+			}
+			blocks = append(blocks, &models.Block{UserID: user.ID, BlockedID: blocked.ID, BlockedAt: at})
+			logBlock(user.ID, blocked.ID, true, at)
+		}
+	}
+
+	if err := insertInBatches(ctx, "block", blocks); err != nil {
+		return err
+	}
+	if err := insertInBatches(ctx, "block_activity", activity); err != nil {
+		return err
+	}
+
+	log.Println("Blocks created")
+	return nil
+}
+
+// createRestricts lets --block-rate of the users restrict up to three of
+// their followers, logged in restrict_activity like blocks.
+func createRestricts(ctx context.Context, rng *rand.Rand) error {
+	accounts, err := loadAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		return nil
+	}
+
+	followersOf := map[string][]models.Follower{}
+	for _, follow := range follows {
+		followersOf[follow.FollowingID] = append(followersOf[follow.FollowingID], follow)
+	}
+
+	restricts := []*models.Restrict{}
+	activity := []*models.RestrictActivity{}
+	logRestrict := func(user, restricted string, isRestrict bool, at time.Time) {
+		activity = append(activity, &models.RestrictActivity{UserID: user, RestrictUserID: restricted, IsRestrict: isRestrict, CreatedAt: at})
+	}
+
+	restricted := map[string]bool{}
+	restricters := int(float64(len(accounts)) * *blockRate)
+	for i := 0; i < restricters; i++ {
+		user := accounts[rng.Intn(len(accounts))]
+		followers := followersOf[user.ID]
+		if len(followers) == 0 {
+			continue
+		}
+		for n := rng.Intn(3) + 1; n > 0; n-- {
+			follow := followers[rng.Intn(len(followers))]
+			key := pairKey(user.ID, follow.FollowerID)
+			if restricted[key] {
+				continue
+			}
+			restricted[key] = true
+
+			at := since(rng, follow.FollowedAt)
+			if rng.Float64() < *churnRate {
+				logRestrict(user.ID, follow.FollowerID, true, at)
+				logRestrict(user.ID, follow.FollowerID, false, timeAfter(rng, at, *activityWindow))
+				continue
+			}
+			restricts = append(restricts, &models.Restrict{UserID: user.ID, RestrictUserID: follow.FollowerID, CreatedAt: at})
+			logRestrict(user.ID, follow.FollowerID, true, at)
+		}
+	}
+
+	if err := insertInBatches(ctx, "restrict", restricts); err != nil {
+		return err
+	}
+	if err := insertInBatches(ctx, "restrict_activity", activity); err != nil {
+		return err
+	}
+
+	log.Println("Restricts created")
+	return nil
+}
+
+// createCommentActivity logs a like for every row of comment_likes, some of
+// them after an earlier like and unlike, and likes that were taken back.
+func createCommentActivity(ctx context.Context, rng *rand.Rand) error {
+	accounts, err := loadAccounts(ctx)
+	if err != nil {
+		return err
+	}
+
+	type commentLike struct {
+		CommentID        int64
+		LikedBy          string
+		LikedAt          time.Time
+		CommentCreatedAt time.Time
+	}
+	comments, err := loadTable[models.Comment](ctx, "comments", "id")
+	if err != nil {
+		return err
+	}
+	commentCreatedAt := map[int64]time.Time{}
+	for _, comment := range comments {
+		commentCreatedAt[comment.ID] = comment.CreatedAt
+	}
+	commentLikes, err := loadTable[models.CommentLike](ctx, "comment_likes", "comment_id, liked_by")
+	if err != nil {
+		return err
+	}
+	likes := make([]commentLike, len(commentLikes))
+	for i, like := range commentLikes {
+		likes[i] = commentLike{CommentID: like.CommentID, LikedBy: like.LikedBy, LikedAt: like.LikedAt, CommentCreatedAt: commentCreatedAt[like.CommentID]}
+	}
+
+	activity, err := newBatchWriter[*models.CommentActivity](ctx, "comment_activity")
+	if err != nil {
+		return err
+	}
+	add := func(commentID int64, user string, isLike bool, at time.Time) error {
+		return activity.Add(&models.CommentActivity{CommentID: commentID, ActionBy: user, IsLike: isLike, CreatedAt: at})
+	}
+
+	liked := map[string]bool{}
+	for _, like := range likes {
+		liked[pairKey(fmt.Sprint(like.CommentID), like.LikedBy)] = true
+	}
+
+	for _, like := range likes {
+		if rng.Float64() < *churnRate {
+			likedAt, unlikedAt := undoneBefore(rng, like.LikedAt)
+			likedAt = latest(likedAt, like.CommentCreatedAt)
+			if err := add(like.CommentID, like.LikedBy, true, likedAt); err != nil {
+				return err
+			}
+			if err := add(like.CommentID, like.LikedBy, false, latest(unlikedAt, likedAt)); err != nil {
+				return err
+			}
+		}
+		if err := add(like.CommentID, like.LikedBy, true, like.LikedAt); err != nil {
+			return err
+		}
+
+		// a like that was taken back by someone who does not like the comment now
+		if len(accounts) == 0 || rng.Float64() >= *churnRate {
+			continue
+		}
+		user := accounts[rng.Intn(len(accounts))]
+		key := pairKey(fmt.Sprint(like.CommentID), user.ID)
+		if liked[key] {
+			continue
+		}
+		liked[key] = true
+		at := timeAfter(rng, latest(like.CommentCreatedAt, user.CreatedAt), *activityWindow)
+		if err := add(like.CommentID, user.ID, true, at); err != nil {
+			return err
+		}
+		if err := add(like.CommentID, user.ID, false, timeAfter(rng, at, *activityWindow)); err != nil {
+			return err
+		}
+	}
+
+	if err := activity.Close(); err != nil {
+		return err
+	}
+
+	log.Println("Comment activity created")
+	return nil
+}
+
+// createHighlightStoryActivity records every highlights_stories row as added
+// and, for some of them, another story of the same user that was added to the
+// highlight and removed again. The table keeps one row per highlight, story
+// and event.
+func createHighlightStoryActivity(ctx context.Context, rng *rand.Rand) error {
+	type highlightStory struct {
+		HighlightID int64
+		StoryID     string
+		UserID      string
+		CreatedAt   time.Time
+	}
+	highlights, err := loadTable[models.Highlight](ctx, "highlights", "id")
+	if err != nil {
+		return err
+	}
+	highlightUser := map[int64]string{}
+	for _, highlight := range highlights {
+		highlightUser[highlight.ID] = highlight.UserID
+	}
+	highlightStories, err := loadTable[models.HighlightsStory](ctx, "highlights_stories", "highlight_id, story_id")
+	if err != nil {
+		return err
+	}
+	added := make([]highlightStory, len(highlightStories))
+	for i, row := range highlightStories {
+		added[i] = highlightStory{HighlightID: row.HighlightID, StoryID: row.StoryID, UserID: highlightUser[row.HighlightID], CreatedAt: row.CreatedAt}
+	}
+
+	stories, err := loadTable[models.Story](ctx, "stories", "id")
+	if err != nil {
+		return err
+	}
+	storiesOf := map[string][]models.Story{}
+	for _, story := range stories {
+		storiesOf[story.UserID] = append(storiesOf[story.UserID], story)
+	}
+
+	inHighlight := map[string]bool{}
+	for _, row := range added {
+		inHighlight[pairKey(fmt.Sprint(row.HighlightID), row.StoryID)] = true
+	}
+
+	activity, err := newBatchWriter[*models.HighlightsStoryActivity](ctx, "highlights_story_activity")
+	if err != nil {
+		return err
+	}
+	for _, row := range added {
+		err := activity.Add(&models.HighlightsStoryActivity{HighlightID: row.HighlightID, StoryID: row.StoryID, CreatedAt: row.CreatedAt})
+		if err != nil {
+			return err
+		}
+
+		candidates := storiesOf[row.UserID]
+		if len(candidates) == 0 || rng.Float64() >= *churnRate {
+			continue
+		}
+		story := candidates[rng.Intn(len(candidates))]
+		key := pairKey(fmt.Sprint(row.HighlightID), story.ID)
+		if inHighlight[key] {
+			continue
+		}
+		addedAt := timeAfter(rng, story.CreatedAt, *activityWindow)
+		if !addedAt.Before(clock()) {
+			// no time left to remove it again
+			continue
+		}
+		inHighlight[key] = true
+		err = activity.Add(&models.HighlightsStoryActivity{HighlightID: row.HighlightID, StoryID: story.ID, CreatedAt: addedAt})
+		if err != nil {
+			return err
+		}
+		err = activity.Add(&models.HighlightsStoryActivity{
+			HighlightID: row.HighlightID,
+			StoryID:     story.ID,
+			IsRemoved:   true,
+			CreatedAt:   timeAfter(rng, addedAt, *activityWindow),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := activity.Close(); err != nil {
+		return err
+	}
+
+	log.Println("Highlight story activity created")
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+// useFileOutput lets a stage run against the spooled rows of a file output
+// instead of a database, with now as the reference time.
+func useFileOutput(t *testing.T, now time.Time) *fileSink {
+	t.Helper()
+	setClock(&now)
+	sink, err := openOutput(outputCSV, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = newIDAllocator(nil)
+	fileOutput = sink
+	t.Cleanup(func() {
+		sink.store.close()
+		fileOutput = nil
+		setClock(nil)
+	})
+	return sink
+}
+
+func TestFollowersActivityReplaysToFollowers(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	churn := *churnRate
+	*churnRate = 0.5
+	t.Cleanup(func() { *churnRate = churn })
+
+	for seed := int64(1); seed <= 5; seed++ {
+		sink := useFileOutput(t, now)
+		ctx := context.Background()
+
+		users := []*models.User{}
+		createdAt := map[string]time.Time{}
+		for i := 0; i < 8; i++ {
+			user := &models.User{ID: fmt.Sprintf("user-%d", i), CreatedAt: now.AddDate(0, -12+i, 0)}
+			users = append(users, user)
+			createdAt[user.ID] = user.CreatedAt
+		}
+		follows := []*models.Follower{}
+		followed := map[string]bool{}
+		for i, follower := range users {
+			for j, following := range users[i+1:] {
+				if (i+j)%3 == 0 {
+					at := latest(follower.CreatedAt, following.CreatedAt).Add(time.Hour)
+					follows = append(follows, &models.Follower{FollowerID: follower.ID, FollowingID: following.ID, FollowedAt: at})
+					followed[pairKey(follower.ID, following.ID)] = true
+				}
+			}
+		}
+		if err := sink.write(ctx, "users", users, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := sink.write(ctx, "followers", follows, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := createFollowersActivity(ctx, stageRand(seed, "followers-activity")); err != nil {
+			t.Fatal(err)
+		}
+		activity, err := loadTable[*models.FollowersActivity](ctx, "followers_activity", "follower_id, following_id, created_at")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(activity) <= len(follows) {
+			t.Errorf("seed %d: %d events for %d follows, want some churn", seed, len(activity), len(follows))
+		}
+
+		// replaying the log of every pair ends in the followers table
+		following := map[string]bool{}
+		last := map[string]time.Time{}
+		for _, event := range activity {
+			key := pairKey(event.FollowerID, event.FollowingID)
+			if event.IsUnfollow != following[key] {
+				t.Errorf("seed %d: %s follows %s twice in a row or unfollows without a follow", seed, event.FollowerID, event.FollowingID)
+			}
+			following[key] = !event.IsUnfollow
+			earliest := latest(createdAt[event.FollowerID], createdAt[event.FollowingID])
+			if event.CreatedAt.Before(earliest) || event.CreatedAt.After(now) || event.CreatedAt.Before(last[key]) {
+				t.Errorf("seed %d: %s logged at %v, out of order or outside %v to %v", seed, key, event.CreatedAt, earliest, now)
+			}
+			last[key] = event.CreatedAt
+		}
+		for key, state := range following {
+			if state != followed[key] {
+				t.Errorf("seed %d: replaying %s ends in following %v, want %v", seed, key, state, followed[key])
+			}
+		}
+		for key := range followed {
+			if !following[key] {
+				t.Errorf("seed %d: follow %s is missing from the log", seed, key)
+			}
+		}
+	}
+}
+
+func TestHighlightStoryActivity(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	churn := *churnRate
+	*churnRate = 1
+	t.Cleanup(func() { *churnRate = churn })
+
+	for seed := int64(1); seed <= 5; seed++ {
+		sink := useFileOutput(t, now)
+		ctx := context.Background()
+
+		highlights := []*models.Highlight{{ID: 1, UserID: "alice", CreatedAt: now.AddDate(0, -6, 0)}, {ID: 2, UserID: "bob", CreatedAt: now.AddDate(0, -6, 0)}}
+		stories := []*models.Story{}
+		storyUser := map[string]string{}
+		for i := 0; i < 6; i++ {
+			user := []string{"alice", "bob"}[i%2]
+			story := &models.Story{ID: fmt.Sprintf("story-%d", i), UserID: user, CreatedAt: now.AddDate(0, -5, i)}
+			stories = append(stories, story)
+			storyUser[story.ID] = user
+		}
+		// the last story of bob was made just before the reference time
+		stories[5].CreatedAt = now.Add(-time.Nanosecond)
+		highlightStories := []*models.HighlightsStory{
+			{HighlightID: 1, StoryID: "story-0", CreatedAt: now.AddDate(0, -4, 0)},
+			{HighlightID: 2, StoryID: "story-1", CreatedAt: now.AddDate(0, -4, 0)},
+		}
+		kept := map[string]bool{pairKey("1", "story-0"): true, pairKey("2", "story-1"): true}
+		for table, rows := range map[string]interface{}{"highlights": highlights, "stories": stories, "highlights_stories": highlightStories} {
+			if err := sink.write(ctx, table, rows, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := createHighlightStoryActivity(ctx, stageRand(seed, "highlight-story-activity")); err != nil {
+			t.Fatal(err)
+		}
+		activity, err := loadTable[*models.HighlightsStoryActivity](ctx, "highlights_story_activity", "highlight_id, story_id, is_removed")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(activity) <= len(highlightStories) {
+			t.Errorf("seed %d: %d events for %d highlight stories, want some churn", seed, len(activity), len(highlightStories))
+		}
+
+		added := map[string]time.Time{}
+		removed := map[string]bool{}
+		for _, event := range activity {
+			key := pairKey(fmt.Sprint(event.HighlightID), event.StoryID)
+			if storyUser[event.StoryID] != highlights[event.HighlightID-1].UserID {
+				t.Errorf("seed %d: story %s of another user in highlight %d", seed, event.StoryID, event.HighlightID)
+			}
+			if event.CreatedAt.After(now) {
+				t.Errorf("seed %d: %s logged at %v, after the reference time", seed, key, event.CreatedAt)
+			}
+			if !event.IsRemoved {
+				added[key] = event.CreatedAt
+				continue
+			}
+			removed[key] = true
+			at, ok := added[key]
+			if !ok || event.CreatedAt.Before(at) {
+				t.Errorf("seed %d: %s removed at %v without being added before", seed, key, event.CreatedAt)
+			}
+		}
+		for key := range kept {
+			if _, ok := added[key]; !ok || removed[key] {
+				t.Errorf("seed %d: highlights_stories row %s is not added for good", seed, key)
+			}
+		}
+		for key := range added {
+			if !kept[key] && !removed[key] {
+				t.Errorf("seed %d: churned %s is added but never removed", seed, key)
+			}
+		}
+	}
+}
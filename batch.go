@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gorm.io/gorm/clause"
+)
+
+// batchWriter collects rows and writes them in batches of size. Every batch is
+// written to the sink together with the checkpoint of the stage, in one
+// transaction, so a failed batch leaves nothing behind and can be retried on
+// its own, and a resumed run continues after the last committed batch.
+type batchWriter[T any] struct {
+	ctx      context.Context
+	table    string
+	size     int
+	sink     sink
+	progress *stageProgress
+	step     int
+	skip     int
+	offset   int
+	pending  []T
+}
+
+// newBatchWriter writes with INSERT, clauses such as ON CONFLICT are added to
+// every statement. A batch is as large as the bind parameters of one INSERT
+// allow.
+func newBatchWriter[T any](ctx context.Context, table string, clauses ...clause.Expression) (*batchWriter[T], error) {
+	var model T
+	size, err := insertBatchSize(model)
+	if err != nil {
+		return nil, err
+	}
+	return newSinkWriter[T](ctx, table, size, insertSink{clauses: clauses}), nil
+}
+
+// newBulkWriter writes a large generated table, with COPY unless --copy=false.
+func newBulkWriter[T any](ctx context.Context, table string) (*batchWriter[T], error) {
+	var model T
+	s, size, err := bulkSink(model)
+	if err != nil {
+		return nil, err
+	}
+	return newSinkWriter[T](ctx, table, size, s), nil
+}
+
+// newSinkWriter writes to s, or to the files when the run writes files.
+func newSinkWriter[T any](ctx context.Context, table string, size int, s sink) *batchWriter[T] {
+	if fileOutput != nil {
+		s = fileOutput
+	}
+	w := &batchWriter[T]{ctx: ctx, table: table, size: size, sink: s, progress: progressFrom(ctx)}
+	if w.progress != nil {
+		w.step = w.progress.calls
+		w.progress.calls++
+		w.skip = w.progress.skip(w.step)
+		if w.skip < 0 {
+			log.Printf("stage %s: %s was already loaded, skipping", w.progress.stage, table)
+		} else if w.skip > 0 {
+			log.Printf("stage %s: resuming %s after %d committed rows", w.progress.stage, table, w.skip)
+		}
+	}
+	return w
+}
+
+// Add queues row and writes a batch once size rows are queued. Rows committed
+// by an earlier attempt of the run are dropped.
+func (w *batchWriter[T]) Add(row T) error {
+	if w.skip < 0 {
+		return nil
+	}
+	if w.offset < w.skip {
+		w.offset++
+		return nil
+	}
+	w.pending = append(w.pending, row)
+	if len(w.pending) >= w.size {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the queued rows.
+func (w *batchWriter[T]) Close() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	return w.flush()
+}
+
+func (w *batchWriter[T]) flush() error {
+	batch := w.pending
+	end := w.offset + len(batch)
+	err := withRetries(w.ctx, func() error {
+		return w.sink.write(w.ctx, w.table, batch, func(exec execFunc) error {
+			if w.progress == nil {
+				return nil
+			}
+			return w.progress.save(exec, w.step, w.table, end)
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("%s batch at offset %d: %w", w.table, w.offset, err)
+	}
+	w.offset = end
+	w.pending = w.pending[:0:0]
+	return nil
+}
+
+// insertInBatches writes rows that are already in memory through a batchWriter.
+func insertInBatches[T any](ctx context.Context, table string, rows []T, clauses ...clause.Expression) error {
+	w, err := newBatchWriter[T](ctx, table, clauses...)
+	if err != nil {
+		return err
+	}
+	return writeAll(w, rows)
+}
+
+// bulkInsert writes rows that are already in memory through a bulk writer.
+func bulkInsert[T any](ctx context.Context, table string, rows []T) error {
+	w, err := newBulkWriter[T](ctx, table)
+	if err != nil {
+		return err
+	}
+	return writeAll(w, rows)
+}
+
+func writeAll[T any](w *batchWriter[T], rows []T) error {
+	for _, row := range rows {
+		if err := w.Add(row); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
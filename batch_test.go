@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"data-loader/models"
+)
+
+// recordingSink keeps the size of every batch written to it.
+type recordingSink struct {
+	batches []int
+}
+
+func (s *recordingSink) write(_ context.Context, _ string, rows interface{}, _ func(execFunc) error) error {
+	s.batches = append(s.batches, reflect.ValueOf(rows).Len())
+	return nil
+}
+
+func TestInsertBatchSizeFitsBindParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		model interface{}
+	}{
+		{name: "users", model: &models.User{}},
+		{name: "businesses", model: &models.Business{}},
+		{name: "locations", model: &models.Location{}},
+		{name: "posts", model: &models.Post{}},
+		{name: "hash_tags", model: &models.HashTag{}},
+		{name: "highlights", model: &models.Highlight{}},
+		{name: "story_views", model: &models.StoryView{}},
+		{name: "post_mentions", model: &models.PostMention{}},
+		{name: "followers_activity", model: &models.FollowersActivity{}},
+		{name: "highlights_story_activity", model: &models.HighlightsStoryActivity{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			size, err := insertBatchSize(tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := modelSchema(tt.model)
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns := len(s.DBNames)
+			if size*columns > maxBindParams {
+				t.Errorf("%d rows of %d columns need %d parameters, more than %d", size, columns, size*columns, maxBindParams)
+			}
+			if (size+1)*columns <= maxBindParams {
+				t.Errorf("%d rows of %d columns leave room for another row", size, columns)
+			}
+		})
+	}
+}
+
+func TestBatchWriterSplitsBatches(t *testing.T) {
+	w, err := newBatchWriter[*models.User](context.Background(), "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &recordingSink{}
+	w.sink = rec
+
+	rows := make([]*models.User, 2*w.size+1)
+	for i := range rows {
+		rows[i] = &models.User{}
+	}
+	if err := writeAll(w, rows); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{w.size, w.size, 1}
+	if !reflect.DeepEqual(rec.batches, want) {
+		t.Errorf("batches %v, want %v", rec.batches, want)
+	}
+}
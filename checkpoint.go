@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"data-loader/models"
+)
+
+const (
+	runRunning   = "running"
+	runFailed    = "failed"
+	runCompleted = "completed"
+)
+
+// loadRun is the loader_runs row of the current load together with the
+// checkpoints its stages reached in an earlier attempt.
+type loadRun struct {
+	models.LoaderRun
+	checkpoints map[string]models.LoaderCheckpoint
+}
+
+// stageProgress tracks the batched inserts of one stage. A stage is rerun from
+// the start on resume, so its n-th batch writer is identified by n: writers
+// before the checkpointed step are skipped, the checkpointed writer skips
+// the rows it already committed.
+type stageProgress struct {
+	run        *loadRun
+	stage      string
+	calls      int
+	resumeStep int
+	resumeRows int
+	completed  bool
+}
+
+type progressKey struct{}
+
+func withProgress(ctx context.Context, progress *stageProgress) context.Context {
+	return context.WithValue(ctx, progressKey{}, progress)
+}
+
+func progressFrom(ctx context.Context) *stageProgress {
+	progress, _ := ctx.Value(progressKey{}).(*stageProgress)
+	return progress
+}
+
+func checkLoaderTables(ctx context.Context) error {
+	var exists bool
+	err := rawDB.QueryRowContext(ctx, `SELECT to_regclass('loader_checkpoints') IS NOT NULL
+	AND EXISTS (SELECT 1 FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = 'loader_runs' AND column_name = 'id_bases')`).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("the loader tables are missing or outdated, run `data-loader migrate` first")
+	}
+	return nil
+}
+
+// startRun records a new run in loader_runs.
+func startRun(ctx context.Context, seed int64, reference *time.Time, selected []*stage) (*loadRun, error) {
+	names := []string{}
+	for _, s := range selected {
+		names = append(names, s.Name)
+	}
+
+	run := &loadRun{
+		LoaderRun: models.LoaderRun{
+			Seed:          seed,
+			ReferenceTime: reference,
+			Stages:        strings.Join(names, ","),
+			Status:        runRunning,
+			StartedAt:     time.Now(),
+		},
+		checkpoints: map[string]models.LoaderCheckpoint{},
+	}
+	if err := db.WithContext(ctx).Create(&run.LoaderRun).Error; err != nil {
+		return nil, fmt.Errorf("recording the run: %w", err)
+	}
+	return run, nil
+}
+
+// resumeRun picks up the most recent run that did not complete.
+func resumeRun(ctx context.Context) (*loadRun, error) {
+	run := &loadRun{checkpoints: map[string]models.LoaderCheckpoint{}}
+	err := db.WithContext(ctx).Where("status <> ?", runCompleted).Order("id desc").First(&run.LoaderRun).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("there is no unfinished run to resume")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var checkpoints []models.LoaderCheckpoint
+	if err := db.WithContext(ctx).Where("run_id = ?", run.ID).Find(&checkpoints).Error; err != nil {
+		return nil, err
+	}
+	for _, checkpoint := range checkpoints {
+		run.checkpoints[checkpoint.Stage] = checkpoint
+	}
+
+	err = db.WithContext(ctx).Model(&models.LoaderRun{}).Where("id = ?", run.ID).
+		Updates(map[string]interface{}{"status": runRunning, "finished_at": nil}).Error
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// finish stores the outcome of the run.
+func (r *loadRun) finish(runErr error) {
+	status := runCompleted
+	if runErr != nil {
+		status = runFailed
+	}
+	err := db.Model(&models.LoaderRun{}).Where("id = ?", r.ID).
+		Updates(map[string]interface{}{"status": status, "finished_at": time.Now()}).Error
+	if err != nil {
+		log.Printf("recording the end of run %d: %v", r.ID, err)
+	}
+}
+
+func (r *loadRun) progress(stage string) *stageProgress {
+	progress := &stageProgress{run: r, stage: stage}
+	if checkpoint, ok := r.checkpoints[stage]; ok {
+		progress.completed = checkpoint.CompletedAt != nil
+		progress.resumeStep = checkpoint.Step
+		progress.resumeRows = int(checkpoint.CommittedRows)
+	}
+	return progress
+}
+
+// skip returns the number of rows the step-th writer of the stage already
+// committed, -1 when all of them were.
+func (p *stageProgress) skip(step int) int {
+	switch {
+	case step < p.resumeStep:
+		return -1
+	case step == p.resumeStep:
+		return p.resumeRows
+	default:
+		return 0
+	}
+}
+
+// save records that the step-th writer committed rows rows, within the
+// transaction of the batch.
+func (p *stageProgress) save(exec execFunc, step int, table string, rows int) error {
+	return exec(`INSERT INTO loader_checkpoints (run_id, stage, step, batch_table, committed_rows, updated_at)
+VALUES ($1, $2, $3, $4, $5, now())
+ON CONFLICT (run_id, stage) DO UPDATE
+SET step = excluded.step, batch_table = excluded.batch_table, committed_rows = excluded.committed_rows, updated_at = excluded.updated_at`,
+		p.run.ID, p.stage, step, table, rows)
+}
+
+func (p *stageProgress) complete(ctx context.Context) error {
+	return db.WithContext(ctx).Exec(`INSERT INTO loader_checkpoints (run_id, stage, step, committed_rows, completed_at, updated_at)
+VALUES (?, ?, ?, 0, now(), now())
+ON CONFLICT (run_id, stage) DO UPDATE
+SET completed_at = excluded.completed_at, updated_at = excluded.updated_at`,
+		p.run.ID, p.stage, p.calls).Error
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestStageProgressSkip(t *testing.T) {
+	completedAt := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	run := &loadRun{checkpoints: map[string]models.LoaderCheckpoint{
+		"comments": {Stage: "comments", Step: 1, CommittedRows: 25},
+		"posts":    {Stage: "posts", Step: 2, CompletedAt: &completedAt},
+	}}
+
+	tests := []struct {
+		name      string
+		stage     string
+		completed bool
+		// skips are the rows skipped by the first three writers of the stage
+		skips []int
+	}{
+		{name: "interrupted stage", stage: "comments", skips: []int{-1, 25, 0}},
+		{name: "completed stage", stage: "posts", completed: true, skips: []int{-1, -1, 0}},
+		{name: "stage without a checkpoint", stage: "stories", skips: []int{0, 0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := run.progress(tt.stage)
+			if progress.completed != tt.completed {
+				t.Errorf("completed %v, want %v", progress.completed, tt.completed)
+			}
+			skips := []int{}
+			for step := range tt.skips {
+				skips = append(skips, progress.skip(step))
+			}
+			if !reflect.DeepEqual(skips, tt.skips) {
+				t.Errorf("skips %v, want %v", skips, tt.skips)
+			}
+		})
+	}
+}
+
+// checkpointSink records the batch sizes and the checkpoints saved with them.
+type checkpointSink struct {
+	batches     []int
+	checkpoints [][]interface{}
+}
+
+func (s *checkpointSink) write(_ context.Context, _ string, rows interface{}, checkpoint func(execFunc) error) error {
+	s.batches = append(s.batches, reflect.ValueOf(rows).Len())
+	return checkpoint(func(_ string, args ...interface{}) error {
+		s.checkpoints = append(s.checkpoints, args)
+		return nil
+	})
+}
+
+func TestBatchWriterResumesAfterCommittedRows(t *testing.T) {
+	run := &loadRun{
+		LoaderRun:   models.LoaderRun{ID: 9},
+		checkpoints: map[string]models.LoaderCheckpoint{"comments": {Stage: "comments", Step: 1, CommittedRows: 25}},
+	}
+	ctx := withProgress(context.Background(), run.progress("comments"))
+	rows := make([]int, 40)
+
+	tests := []struct {
+		name        string
+		table       string
+		batches     []int
+		checkpoints [][]interface{}
+	}{
+		{name: "writer before the checkpoint", table: "comments"},
+		{
+			name:        "checkpointed writer",
+			table:       "comment_likes",
+			batches:     []int{10, 5},
+			checkpoints: [][]interface{}{{int64(9), "comments", 1, "comment_likes", 35}, {int64(9), "comments", 1, "comment_likes", 40}},
+		},
+		{
+			name:    "writer after the checkpoint",
+			table:   "comment_activity",
+			batches: []int{10, 10, 10, 10},
+			checkpoints: [][]interface{}{
+				{int64(9), "comments", 2, "comment_activity", 10}, {int64(9), "comments", 2, "comment_activity", 20},
+				{int64(9), "comments", 2, "comment_activity", 30}, {int64(9), "comments", 2, "comment_activity", 40},
+			},
+		},
+	}
+
+	// the writers run in order, as within the stage, so their steps are 0, 1, 2
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &checkpointSink{}
+			if err := writeAll(newSinkWriter[int](ctx, tt.table, 10, s), rows); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.batches, tt.batches) {
+				t.Errorf("batches %v, want %v", s.batches, tt.batches)
+			}
+			if !reflect.DeepEqual(s.checkpoints, tt.checkpoints) {
+				t.Errorf("checkpoints %v, want %v", s.checkpoints, tt.checkpoints)
+			}
+		})
+	}
+}
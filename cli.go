@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type command struct {
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = map[string]*command{
+	"load": {
+		usage:   "load [--resume] <stage>... | all",
+		summary: "load the given stages, or every stage with all",
+		run:     runLoad,
+	},
+	"ingest": {
+		usage:   "ingest [--dry-run] <dump.json>",
+		summary: "merge a new profile dump into a loaded database and report the changes",
+		run:     runIngest,
+	},
+	"migrate": {
+		usage:   "migrate",
+		summary: "apply the schema changes made after ddl.sql to an existing database",
+		run:     runMigrate,
+	},
+	"verify": {
+		usage:   "verify [--fix]",
+		summary: "check the counters and references of a loaded database, --fix repairs the counters",
+		run:     runVerify,
+	},
+	"list-stages": {
+		usage:   "list-stages",
+		summary: "list the stages with their prerequisites and tables",
+		run:     runListStages,
+	},
+}
+
+var commandOrder = []string{"load", "ingest", "verify", "list-stages", "migrate"}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: data-loader [flags] <command> [arguments]\n\nCommands:\n")
+	for _, name := range commandOrder {
+		cmd := commands[name]
+		fmt.Fprintf(out, "  %-40s %s\n", cmd.usage, cmd.summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// newFlagSet creates the flag set of a subcommand with a usage line matching the top level one.
+func newFlagSet(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: data-loader [flags] %s\n", usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// validateRates checks that every rate flag, keyed by flag name, is between 0
+// and 1. The names are checked in order so that the error is stable.
+func validateRates(rates map[string]float64) error {
+	names := make([]string, 0, len(rates))
+	for name := range rates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if value := rates[name]; value < 0 || value > 1 {
+			return fmt.Errorf("invalid --%s %v, expected a value between 0 and 1", name, value)
+		}
+	}
+	return nil
+}
+
+func runLoad(args []string) error {
+	fs := newFlagSet("load", "load [--resume] <stage>... | all")
+	opts := runOptions{}
+	fs.IntVar(&opts.Parallel, "parallel", 3, "maximum number of stages running at the same time")
+	fs.StringVar(&opts.Policy.Mode, "on-error", onErrorStop, "what to do when a stage fails: stop, retry or continue")
+	fs.IntVar(&opts.Policy.Retries, "retries", 3, "attempts per statement failing with a transient error when --on-error=retry")
+	fs.DurationVar(&opts.Policy.RetryDelay, "retry-delay", 2*time.Second, "delay before the first retry, grows with every attempt")
+	resume := fs.Bool("resume", false, "continue the last unfinished run, skipping its completed stages and committed batches")
+	fs.StringVar(&onConflict, "on-conflict", conflictFail, "existing users, locations, hash_tags and posts: skip, update or fail")
+	fs.Parse(args)
+
+	if err := opts.Policy.validate(); err != nil {
+		return err
+	}
+	if err := validateConflictMode(onConflict); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	selected, err := selectStages(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	if *outputFormat != outputPostgres {
+		if *resume {
+			return fmt.Errorf("--resume needs the checkpoints of a database, a run writing %s files starts over", *outputFormat)
+		}
+		return loadFiles(selected, opts)
+	}
+
+	if err := openDatabase(); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := checkLoaderTables(ctx); err != nil {
+		return err
+	}
+	if err := checkSelection(selected); err != nil {
+		return err
+	}
+
+	if *resume {
+		opts.Run, err = resumeRun(ctx)
+		if err != nil {
+			return err
+		}
+		if seed, explicit := resolveSeed(); explicit && seed != opts.Run.Seed {
+			log.Printf("ignoring --seed %d, run %d is resumed with its own seed", seed, opts.Run.ID)
+		}
+		setClock(opts.Run.ReferenceTime)
+		log.Printf("resuming run %d with seed %d", opts.Run.ID, opts.Run.Seed)
+	} else {
+		seed, seeded := resolveSeed()
+		reference, err := resolveNow(seeded)
+		if err != nil {
+			return err
+		}
+		setClock(reference)
+		opts.Run, err = startRun(ctx, seed, reference, selected)
+		if err != nil {
+			return err
+		}
+		log.Printf("run %d, seed %d, rerun with --seed %d to reproduce this data", opts.Run.ID, seed, seed)
+	}
+	opts.Seed = opts.Run.Seed
+	runSeed = opts.Seed
+	ids = newIDAllocator(opts.Run)
+
+	if err := checkSelectedDataset(selected); err != nil {
+		opts.Run.finish(err)
+		return err
+	}
+
+	err = schedule(ctx, selected, opts)
+	// also after a failure, rows written so far must not collide with later inserts
+	if advanceErr := ids.advance(context.Background()); advanceErr != nil {
+		if err != nil {
+			log.Print(advanceErr)
+		} else {
+			err = advanceErr
+		}
+	}
+	opts.Run.finish(err)
+	return err
+}
+
+// loadFiles runs the selected stages without a database, writing the tables
+// to files in --output-dir. Every required stage has to be part of the run.
+func loadFiles(selected []*stage, opts runOptions) error {
+	inRun := map[string]bool{}
+	for _, s := range selected {
+		inRun[s.Name] = true
+	}
+	for _, s := range selected {
+		for _, name := range s.Requires {
+			if !inRun[name] {
+				return fmt.Errorf("stage %s requires %s, which has to run in the same load when writing files", s.Name, name)
+			}
+		}
+	}
+
+	seed, seeded := resolveSeed()
+	reference, err := resolveNow(seeded)
+	if err != nil {
+		return err
+	}
+	setClock(reference)
+	opts.Seed = seed
+	runSeed = seed
+	log.Printf("writing %s files to %s with seed %d, rerun with --seed %d to reproduce this data", *outputFormat, *outputDir, seed, seed)
+
+	if err := checkSelectedDataset(selected); err != nil {
+		return err
+	}
+
+	ids = newIDAllocator(nil)
+	fileOutput, err = openOutput(*outputFormat, *outputDir)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err = schedule(ctx, selected, opts)
+	if closeErr := fileOutput.close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// checkSelectedDataset validates the dataset once if a selected stage reads it.
+func checkSelectedDataset(selected []*stage) error {
+	for _, s := range selected {
+		if s.ReadsDataset {
+			return checkDataset(*datasetFile)
+		}
+	}
+	return nil
+}
+
+func runListStages(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STAGE\tREQUIRES\tTABLES\tDESCRIPTION")
+	for _, s := range stages {
+		requires := strings.Join(s.Requires, ",")
+		if requires == "" {
+			requires = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Name, requires, strings.Join(s.Tables, ","), s.Description)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the resolved database connection settings.
+type Config struct {
+	Host            string
+	Port            string
+	User            string
+	Password        string
+	DBName          string
+	SSLMode         string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// defaultConfig matches the docker compose setup described in the Readme.
+func defaultConfig() Config {
+	return Config{
+		Host:            "localhost",
+		Port:            "5432",
+		User:            "SYS",
+		Password:        "instaadmin",
+		SSLMode:         "disable",
+		MaxOpenConns:    10,
+		MaxIdleConns:    5,
+		ConnMaxLifetime: 30 * time.Minute,
+	}
+}
+
+var (
+	configFile      = flag.String("config", "", "optional env style config file, e.g. docker-compose-local.env")
+	dbHost          = flag.String("host", "", "database host (env PGHOST)")
+	dbPort          = flag.String("port", "", "database port (env PGPORT)")
+	dbUser          = flag.String("user", "", "database user (env POSTGRES_USER, PGUSER)")
+	dbPassword      = flag.String("password", "", "database password (env POSTGRES_PASSWORD, PGPASSWORD)")
+	dbName          = flag.String("dbname", "", "database name (env POSTGRES_DB, PGDATABASE)")
+	dbSSLMode       = flag.String("sslmode", "", "disable|allow|prefer|require|verify-ca|verify-full (env PGSSLMODE)")
+	maxOpenConns    = flag.Int("max-open-conns", 0, "connection pool size (env DATA_LOADER_MAX_OPEN_CONNS)")
+	maxIdleConns    = flag.Int("max-idle-conns", 0, "idle connections kept in the pool (env DATA_LOADER_MAX_IDLE_CONNS)")
+	connMaxLifetime = flag.Duration("conn-max-lifetime", 0, "maximum lifetime of a pooled connection (env DATA_LOADER_CONN_MAX_LIFETIME)")
+)
+
+var validSSLModes = map[string]bool{
+	"disable":     true,
+	"allow":       true,
+	"prefer":      true,
+	"require":     true,
+	"verify-ca":   true,
+	"verify-full": true,
+}
+
+// loadConfig resolves the settings from, in increasing priority, the defaults,
+// the config file, the environment and the command line flags.
+func loadConfig() (Config, error) {
+	cfg := defaultConfig()
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("DATA_LOADER_CONFIG")
+	}
+
+	fileValues := map[string]string{}
+	if path != "" {
+		var err error
+		fileValues, err = readEnvFile(path)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := applyValues(&cfg, func(key string) (string, bool) {
+		value, ok := fileValues[key]
+		return value, ok
+	}); err != nil {
+		return cfg, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if err := applyValues(&cfg, os.LookupEnv); err != nil {
+		return cfg, fmt.Errorf("environment: %w", err)
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "host":
+			cfg.Host = *dbHost
+		case "port":
+			cfg.Port = *dbPort
+		case "user":
+			cfg.User = *dbUser
+		case "password":
+			cfg.Password = *dbPassword
+		case "dbname":
+			cfg.DBName = *dbName
+		case "sslmode":
+			cfg.SSLMode = *dbSSLMode
+		case "max-open-conns":
+			cfg.MaxOpenConns = *maxOpenConns
+		case "max-idle-conns":
+			cfg.MaxIdleConns = *maxIdleConns
+		case "conn-max-lifetime":
+			cfg.ConnMaxLifetime = *connMaxLifetime
+		}
+	})
+
+	return cfg, cfg.validate()
+}
+
+// applyValues copies every key known to lookup into cfg. The POSTGRES_* keys
+// used by docker-compose-local.env describe the server the container was
+// created with, so they win over the generic libpq PG* variables.
+func applyValues(cfg *Config, lookup func(string) (string, bool)) error {
+	first := func(keys ...string) (string, bool) {
+		for _, key := range keys {
+			if value, ok := lookup(key); ok && value != "" {
+				return value, true
+			}
+		}
+		return "", false
+	}
+
+	if value, ok := first("PGHOST"); ok {
+		cfg.Host = value
+	}
+	if value, ok := first("PGPORT"); ok {
+		cfg.Port = value
+	}
+	if value, ok := first("POSTGRES_USER", "PGUSER"); ok {
+		cfg.User = value
+	}
+	if value, ok := first("POSTGRES_PASSWORD", "PGPASSWORD"); ok {
+		cfg.Password = value
+	}
+	if value, ok := first("POSTGRES_DB", "PGDATABASE"); ok {
+		cfg.DBName = value
+	}
+	if value, ok := first("PGSSLMODE"); ok {
+		cfg.SSLMode = value
+	}
+	if value, ok := first("DATA_LOADER_MAX_OPEN_CONNS"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("DATA_LOADER_MAX_OPEN_CONNS: %w", err)
+		}
+		cfg.MaxOpenConns = n
+	}
+	if value, ok := first("DATA_LOADER_MAX_IDLE_CONNS"); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("DATA_LOADER_MAX_IDLE_CONNS: %w", err)
+		}
+		cfg.MaxIdleConns = n
+	}
+	if value, ok := first("DATA_LOADER_CONN_MAX_LIFETIME"); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("DATA_LOADER_CONN_MAX_LIFETIME: %w", err)
+		}
+		cfg.ConnMaxLifetime = d
+	}
+	return nil
+}
+
+// readEnvFile parses KEY=VALUE lines in the same format as docker-compose-local.env.
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+	return values, scanner.Err()
+}
+
+func (c Config) validate() error {
+	if c.Host == "" {
+		return fmt.Errorf("database host is required")
+	}
+	if _, err := strconv.Atoi(c.Port); err != nil {
+		return fmt.Errorf("invalid database port %q", c.Port)
+	}
+	if !validSSLModes[c.SSLMode] {
+		return fmt.Errorf("invalid sslmode %q", c.SSLMode)
+	}
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return fmt.Errorf("connection pool sizes must not be negative")
+	}
+	return nil
+}
+
+// DSN builds a libpq keyword/value connection string.
+func (c Config) DSN() string {
+	parts := []string{
+		"host=" + quoteDSN(c.Host),
+		"port=" + quoteDSN(c.Port),
+		"user=" + quoteDSN(c.User),
+		"password=" + quoteDSN(c.Password),
+		"sslmode=" + quoteDSN(c.SSLMode),
+	}
+	if c.DBName != "" {
+		parts = append(parts, "dbname="+quoteDSN(c.DBName))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteDSN(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// String prints the resolved settings with the password masked.
+func (c Config) String() string {
+	password := ""
+	if c.Password != "" {
+		password = "****"
+	}
+	dbname := c.DBName
+	if dbname == "" {
+		dbname = "(default)"
+	}
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s max_open_conns=%d max_idle_conns=%d conn_max_lifetime=%s",
+		c.Host, c.Port, c.User, password, dbname, c.SSLMode, c.MaxOpenConns, c.MaxIdleConns, c.ConnMaxLifetime)
+}
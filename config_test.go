@@ -0,0 +1,132 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		flags   map[string]string
+		want    func(*Config)
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: func(*Config) {},
+		},
+		{
+			name: "file over defaults",
+			file: "PGHOST=filehost\nPGPORT=6000\n",
+			want: func(c *Config) { c.Host, c.Port = "filehost", "6000" },
+		},
+		{
+			name: "env over file",
+			file: "PGHOST=filehost\nPGPORT=6000\n",
+			env:  map[string]string{"PGHOST": "envhost"},
+			want: func(c *Config) { c.Host, c.Port = "envhost", "6000" },
+		},
+		{
+			name:  "flag over env",
+			file:  "PGHOST=filehost\nPOSTGRES_DB=filedb\n",
+			env:   map[string]string{"PGHOST": "envhost", "DATA_LOADER_MAX_OPEN_CONNS": "20"},
+			flags: map[string]string{"host": "flaghost"},
+			want: func(c *Config) {
+				c.Host, c.DBName, c.MaxOpenConns = "flaghost", "filedb", 20
+			},
+		},
+		{
+			name:  "flag over file",
+			file:  "PGSSLMODE=require\n",
+			flags: map[string]string{"sslmode": "verify-full", "max-idle-conns": "1"},
+			want:  func(c *Config) { c.SSLMode, c.MaxIdleConns = "verify-full", 1 },
+		},
+		{
+			name: "POSTGRES_USER over PGUSER",
+			env:  map[string]string{"PGUSER": "pguser", "POSTGRES_USER": "postgres"},
+			want: func(c *Config) { c.User = "postgres" },
+		},
+		{
+			name:    "invalid env value",
+			env:     map[string]string{"DATA_LOADER_MAX_IDLE_CONNS": "many"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid file value",
+			file:    "PGSSLMODE=sometimes\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				"DATA_LOADER_CONFIG", "PGHOST", "PGPORT", "POSTGRES_USER", "PGUSER", "POSTGRES_PASSWORD", "PGPASSWORD",
+				"POSTGRES_DB", "PGDATABASE", "PGSSLMODE", "DATA_LOADER_MAX_OPEN_CONNS", "DATA_LOADER_MAX_IDLE_CONNS",
+				"DATA_LOADER_CONN_MAX_LIFETIME",
+			} {
+				t.Setenv(key, "")
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "loader.env")
+				if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			setFlags(t, map[string]string{"config": path})
+			setFlags(t, tt.flags)
+
+			cfg, err := loadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", cfg)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := defaultConfig()
+			tt.want(&want)
+			if cfg != want {
+				t.Errorf("got %+v, want %+v", cfg, want)
+			}
+		})
+	}
+}
+
+// setFlags sets the named command line flags for the test. They are set on a
+// copy of flag.CommandLine, so that flag.Visit no longer sees them once the
+// test restored it with the previous values.
+func setFlags(t *testing.T, values map[string]string) {
+	t.Helper()
+	saved := flag.CommandLine
+	fs := flag.NewFlagSet(saved.Name(), flag.ContinueOnError)
+	saved.VisitAll(func(f *flag.Flag) { fs.Var(f.Value, f.Name, f.Usage) })
+	saved.Visit(func(f *flag.Flag) { fs.Set(f.Name, f.Value.String()) })
+	flag.CommandLine = fs
+
+	previous := map[string]string{}
+	for name, value := range values {
+		previous[name] = fs.Lookup(name).Value.String()
+		if err := fs.Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		for name, value := range previous {
+			fs.Lookup(name).Value.Set(value)
+		}
+		flag.CommandLine = saved
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	conflictFail   = "fail"
+	conflictSkip   = "skip"
+	conflictUpdate = "update"
+)
+
+// onConflict decides what happens when users, locations, hash_tags or posts
+// already contain a row with the same natural key.
+//
+//	fail:   the insert fails, as on an empty database
+//	skip:   the existing row is kept as it is
+//	update: the existing row is refreshed from the dataset
+var onConflict = conflictFail
+
+func validateConflictMode(mode string) error {
+	switch mode {
+	case conflictFail, conflictSkip, conflictUpdate:
+		return nil
+	}
+	return fmt.Errorf("invalid --on-conflict %q, expected skip, update or fail", mode)
+}
+
+// conflictClauses returns the ON CONFLICT clause for rows identified by the
+// key columns, updates are the columns refreshed in update mode.
+func conflictClauses(key []string, updates []string) []clause.Expression {
+	columns := []clause.Column{}
+	for _, name := range key {
+		columns = append(columns, clause.Column{Name: name})
+	}
+
+	switch {
+	case onConflict == conflictSkip, onConflict == conflictUpdate && len(updates) == 0:
+		return []clause.Expression{clause.OnConflict{Columns: columns, DoNothing: true}}
+	case onConflict == conflictUpdate:
+		return []clause.Expression{clause.OnConflict{Columns: columns, DoUpdates: clause.AssignmentColumns(updates)}}
+	}
+	return nil
+}
+
+func userConflict() []clause.Expression {
+	return conflictClauses([]string{"username"}, []string{
+		"following_count", "followers_count", "bio", "posts_count", "highlights_count", "name",
+		"profile_image_link", "is_business", "is_verified", "country", "region", "updated_at",
+	})
+}
+
+func locationConflict() []clause.Expression {
+	return conflictClauses([]string{"name"}, []string{"has_public_page", "slug"})
+}
+
+// a hashtag has nothing but its name, so update keeps the row like skip
+func hashTagConflict() []clause.Expression {
+	return conflictClauses([]string{"name"}, nil)
+}
+
+func postConflict() []clause.Expression {
+	return conflictClauses([]string{"url"}, []string{
+		"caption", "likes_count", "comments_count", "video_view_count", "primary_image_url",
+		"primary_video_url", "location_id", "is_sponsored", "sponsor_id", "updated_at",
+	})
+}
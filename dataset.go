@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"data-loader/models"
+)
+
+var datasetFile = flag.String("dataset", "instagram_profiles_Github Hashtag_dataset.json", "scraped profile dataset to load")
+
+type Data struct {
+	Account               string          `json:"account,omitempty"`
+	Biography             string          `json:"biography,omitempty"`
+	BusinessAddressJson   BusinessAddress `json:"business_address_json,omitempty"`
+	BusinessCategoryName  string          `json:"business_category_name,omitempty"`
+	BusinessEmail         string          `json:"business_email,omitempty"`
+	ExternalUrl           string          `json:"external_url,omitempty"`
+	Fbid                  string          `json:"fbid,omitempty"`
+	Followers             int64           `json:"followers,omitempty"`
+	Following             int64           `json:"following,omitempty"`
+	Highlights            []DataHighlight `json:"highlights,omitempty"`
+	Id                    string          `json:"id,omitempty"`
+	IsBusinessAccount     bool            `json:"is_business_account,omitempty"`
+	IsProfessionalAccount bool            `json:"is_professional_account,omitempty"`
+	IsVerified            bool            `json:"is_verified,omitempty"`
+	Posts                 []DataPost      `json:"posts,omitempty"`
+	PostsCount            int64           `json:"posts_count,omitempty"`
+	ProfileImageLink      string          `json:"profile_image_link,omitempty"`
+	ProfileName           string          `json:"profile_name,omitempty"`
+	HighlightsCount       int64           `json:"highlights_count,omitempty"`
+	CountryCode           string          `json:"country_code,omitempty"`
+	Region                string          `json:"region,omitempty"`
+	AvgEngagement         float64         `json:"avg_engagement,omitempty"`
+	PostHashtags          []string        `json:"post_hashtags,omitempty"`
+}
+
+type BusinessAddress struct {
+	CityName      string  `json:"city_name,omitempty"`
+	CityId        int64   `json:"city_id,omitempty"`
+	Latitude      float64 `json:"latitude,omitempty"`
+	Longitude     float64 `json:"longitude,omitempty"`
+	StreetAddress string  `json:"street_address,omitempty"`
+	ZipCode       string  `json:"zip_code,omitempty"`
+}
+
+type DataHighlight struct {
+	Id    string `json:"id,omitempty"`
+	Title string `json:"title,omitempty"`
+	Image string `json:"image,omitempty"`
+	Owner string `json:"owner,omitempty"`
+}
+
+type DataPost struct {
+	Caption        string        `json:"caption,omitempty"`
+	Likes          int64         `json:"likes,omitempty"`
+	Datetime       int           `json:"datetime,omitempty"`
+	ImageUrl       string        `json:"image_url,omitempty"`
+	Id             string        `json:"id,omitempty"`
+	Location       *DataLocation `json:"location,omitempty"`
+	Url            string        `json:"url,omitempty"`
+	Comments       int64         `json:"comments,omitempty"`
+	VideoViewCount int64         `json:"video_view_count,omitempty,omitempty"`
+	VideoUrl       string        `json:"video_url,omitempty,omitempty"`
+}
+
+type DataLocation struct {
+	Id            string `json:"id,omitempty"`
+	HasPublicPage bool   `json:"has_public_page,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Slug          string `json:"slug,omitempty"`
+}
+
+// forEachProfile streams the valid profiles of the scraped dataset, one at a
+// time, together with their clones when --scale is set.
+func forEachProfile(fn func(Data) error) error {
+	if *scaleFactor != 1 {
+		return forEachScaledProfile(*datasetFile, fn)
+	}
+	return forEachValidProfile(*datasetFile, fn)
+}
+
+func newUser(rng *rand.Rand, data Data) *models.User {
+	return &models.User{
+		ID:               newUUID(rng),
+		Username:         data.Account,
+		FollowingCount:   data.Following,
+		FollowersCount:   data.Followers,
+		Bio:              data.Biography,
+		PostsCount:       data.PostsCount,
+		HighlightsCount:  data.HighlightsCount,
+		Name:             data.ProfileName,
+		ProfileImageLink: data.ProfileImageLink,
+		IsBusiness:       data.IsBusinessAccount,
+		IsVerified:       data.IsVerified,
+		Country:          data.CountryCode,
+		Region:           data.Region,
+		CreatedAt:        joinedAt(rng, data),
+	}
+}
+
+func newBusiness(rng *rand.Rand, data Data, userID string) *models.Business {
+	// zip codes were validated, an empty one is stored as 0
+	atoi, _ := strconv.Atoi(data.BusinessAddressJson.ZipCode)
+	return &models.Business{
+		ID:            newUUID(rng),
+		CityName:      data.BusinessAddressJson.CityName,
+		Latitude:      data.BusinessAddressJson.Latitude,
+		Longitude:     data.BusinessAddressJson.Longitude,
+		StreetAddress: data.BusinessAddressJson.StreetAddress,
+		ZipCode:       atoi,
+		UserID:        userID,
+	}
+}
+
+func newPost(postData DataPost, userID string, locationIDs map[string]int64) (*models.Post, error) {
+	post := &models.Post{
+		UserID:          userID,
+		Caption:         postData.Caption,
+		LikesCount:      postData.Likes,
+		CommentsCount:   postData.Comments,
+		VideoViewCount:  postData.VideoViewCount,
+		PrimaryImageURL: postData.ImageUrl,
+		PrimaryVideoURL: postData.VideoUrl,
+		URL:             postData.Url,
+		CreatedAt:       postedAt(postData),
+	}
+	if postData.Location != nil {
+		locationID, ok := locationIDs[postData.Location.Name]
+		if !ok {
+			return nil, fmt.Errorf("location %q is not loaded, run the locations stage first", postData.Location.Name)
+		}
+		post.LocationID = &locationID
+	}
+	return post, nil
+}
+
+// locationName is the location of a post in the dataset, empty when it has none.
+func locationName(postData DataPost) string {
+	if postData.Location == nil {
+		return ""
+	}
+	return postData.Location.Name
+}
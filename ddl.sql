@@ -105,7 +105,9 @@ create table posts
     sponsor_id        uuid
         constraint posts_sponsor_id_fk
             references users,
-    url               text                                  not null,
+    url               text                                  not null
+        constraint posts_url_uk
+            unique,
     created_at        timestamptz default current_timestamp not null,
     updated_at        timestamptz,
     deleted_at        timestamptz
@@ -197,7 +199,7 @@ create table highlights_story_activity
     is_removed   bool        default false             not null,
     created_at   timestamptz default current_timestamp not null,
     constraint highlights_story_activity_pk
-        primary key (story_id, highlight_id)
+        primary key (story_id, highlight_id, is_removed)
 );
 
 create table hash_tags
@@ -247,6 +249,38 @@ create table story_tags
         primary key (story_id, tag_id)
 );
 
+create table post_mentions
+(
+    post_id           bigint
+        constraint post_mentions_posts_id_fk
+            references posts,
+    mentioned_user_id uuid
+        constraint post_mentions_users_id_fk
+            references users,
+    created_at        timestamptz default current_timestamp not null,
+    constraint post_mentions_pk
+        primary key (post_id, mentioned_user_id)
+);
+
+create table post_image_user_tags
+(
+    post_image_id bigint
+        constraint post_image_user_tags_post_images_id_fk
+            references post_images,
+    user_id       uuid
+        constraint post_image_user_tags_users_id_fk
+            references users,
+    x             double precision                      not null
+        constraint post_image_user_tags_x_check
+            check (x between 0 and 1),
+    y             double precision                      not null
+        constraint post_image_user_tags_y_check
+            check (y between 0 and 1),
+    created_at    timestamptz default current_timestamp not null,
+    constraint post_image_user_tags_pk
+        primary key (post_image_id, user_id)
+);
+
 create table block
 (
     user_id    uuid
@@ -312,7 +346,9 @@ create table comments
     user_id           uuid
         constraint comments_users_id_fk
             references users,
-    parent_comment_id bigint,
+    parent_comment_id bigint
+        constraint comments_comments_id_fk
+            references comments,
     comment_text      text                                  not null,
     created_at        timestamptz default current_timestamp not null,
     updated_at        timestamptz,
@@ -357,6 +393,115 @@ create table post_likes
         primary key (post_id, user_id)
 );
 
+create table comment_mentions
+(
+    comment_id        bigint
+        constraint comment_mentions_comments_id_fk
+            references comments,
+    mentioned_user_id uuid
+        constraint comment_mentions_users_id_fk
+            references users,
+    created_at        timestamptz default current_timestamp not null,
+    constraint comment_mentions_pk
+        primary key (comment_id, mentioned_user_id)
+);
+
+create table conversations
+(
+    id              bigint generated by default as identity
+        constraint conversations_pk
+            primary key,
+    is_group        bool        default false             not null,
+    title           varchar,
+    created_by      uuid                                  not null
+        constraint conversations_users_id_fk
+            references users,
+    last_message_at timestamptz,
+    created_at      timestamptz default current_timestamp not null,
+    updated_at      timestamptz,
+    deleted_at      timestamptz
+);
+
+create table messages
+(
+    id              bigint generated by default as identity
+        constraint messages_pk
+            primary key,
+    conversation_id bigint                                not null
+        constraint messages_conversations_id_fk
+            references conversations,
+    sender_id       uuid                                  not null
+        constraint messages_users_id_fk
+            references users,
+    text            text,
+    shared_post_id  bigint
+        constraint messages_posts_id_fk
+            references posts,
+    read_at         timestamptz,
+    created_at      timestamptz default current_timestamp not null,
+    deleted_at      timestamptz
+);
+
+create table conversation_participants
+(
+    conversation_id      bigint                                not null
+        constraint conversation_participants_conversations_id_fk
+            references conversations,
+    user_id              uuid                                  not null
+        constraint conversation_participants_users_id_fk
+            references users,
+    joined_at            timestamptz default current_timestamp not null,
+    last_read_message_id bigint
+        constraint conversation_participants_messages_id_fk
+            references messages,
+    last_read_at         timestamptz,
+    constraint conversation_participants_pk
+        primary key (conversation_id, user_id)
+);
+
+create table message_reactions
+(
+    message_id bigint                                not null
+        constraint message_reactions_messages_id_fk
+            references messages,
+    user_id    uuid                                  not null
+        constraint message_reactions_users_id_fk
+            references users,
+    reaction   varchar                               not null,
+    created_at timestamptz default current_timestamp not null,
+    constraint message_reactions_pk
+        primary key (message_id, user_id)
+);
+
+create table loader_runs
+(
+    id             bigint generated by default as identity
+        constraint loader_runs_pk
+            primary key,
+    seed           bigint                                not null,
+    reference_time timestamptz,
+    stages         text                                  not null,
+    status         varchar     default 'running'         not null,
+    started_at     timestamptz default current_timestamp not null,
+    finished_at    timestamptz,
+    id_bases       jsonb
+);
+
+create table loader_checkpoints
+(
+    run_id         bigint                                not null
+        constraint loader_checkpoints_loader_runs_id_fk
+            references loader_runs,
+    stage          varchar                               not null,
+    step           integer     default 0                 not null,
+    batch_table    varchar,
+    committed_rows bigint      default 0                 not null,
+    completed_at   timestamptz,
+    updated_at     timestamptz default current_timestamp not null,
+    constraint loader_checkpoints_pk
+        primary key (run_id, stage)
+);
+
 -- users
 CREATE INDEX idx_followers_count ON users (followers_count);
 CREATE INDEX idx_username ON users (username);
@@ -412,6 +557,30 @@ CREATE INDEX idx_post_tags_tag_id ON post_tags (tag_id);
 CREATE INDEX idx_story_tags_story_id ON story_tags (story_id);
 CREATE INDEX idx_story_tags_tag_id ON story_tags (tag_id);
 
+-- post_mentions
+CREATE INDEX idx_post_mentions_mentioned_user_id ON post_mentions (mentioned_user_id);
+
+-- comment_mentions
+CREATE INDEX idx_comment_mentions_mentioned_user_id ON comment_mentions (mentioned_user_id);
+
+-- post_image_user_tags
+CREATE INDEX idx_post_image_user_tags_user_id ON post_image_user_tags (user_id);
+
+-- conversations
+CREATE INDEX idx_conversations_created_by ON conversations (created_by);
+CREATE INDEX idx_conversations_last_message_at ON conversations (last_message_at);
+
+-- messages
+CREATE INDEX idx_messages_conversation_id_created_at ON messages (conversation_id, created_at);
+CREATE INDEX idx_messages_sender_id ON messages (sender_id);
+CREATE INDEX idx_messages_shared_post_id ON messages (shared_post_id);
+
+-- conversation_participants
+CREATE INDEX idx_conversation_participants_user_id ON conversation_participants (user_id);
+
+-- message_reactions
+CREATE INDEX idx_message_reactions_user_id ON message_reactions (user_id);
+
 -- block
 CREATE INDEX idx_block_user_id ON block (user_id);
 CREATE INDEX idx_block_blocked_id ON block (blocked_id);
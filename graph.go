@@ -0,0 +1,184 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+var (
+	reciprocity = flag.Float64("reciprocity", 0.3, "probability that a generated follow is followed back")
+	clustering  = flag.Float64("clustering", 0.1, "probability that a user follows someone followed by an account they follow instead of a random account")
+	hubReach    = flag.Float64("hub-reach", 0.5, "approximate fraction of the unscaled users following the most followed account, scraped counts are scaled to match")
+)
+
+// follow is an edge of the follower graph, from follower to followed, as
+// indexes into the users the graph was generated for.
+type follow struct {
+	from, to int
+}
+
+// followGraph is a directed graph built by a configuration model: follows are
+// drawn with the follower picked in proportion to its target following count
+// and the followed account in proportion to its target followers count, so
+// both degree distributions keep the heavy tail of the scraped counts.
+type followGraph struct {
+	rng     *rand.Rand
+	n       int
+	edges   []follow
+	exists  map[uint64]bool
+	out     [][]int
+	in      []int
+	outCum  []float64
+	inCum   []float64
+	targetE int
+	// followed are the users with a positive scraped followers count, who
+	// get at least one follower
+	followed []bool
+}
+
+// newFollowGraph scales the scraped counts to the population: the largest
+// count becomes about --hub-reach of the users, and followers and following are
+// balanced to the same number of edges. A positive count never scales below one
+// follow. The population is that of the dataset before --scale, and the hub is
+// the --scale-th largest count, as the most followed profile has that many
+// copies, so that clones keep the degrees of their profile and the follows grow
+// in proportion to the users.
+func newFollowGraph(rng *rand.Rand, followersCounts, followingCounts []int) (*followGraph, error) {
+	if err := validateRates(map[string]float64{"reciprocity": *reciprocity, "clustering": *clustering, "hub-reach": *hubReach}); err != nil {
+		return nil, err
+	}
+
+	n := len(followersCounts)
+	g := &followGraph{rng: rng, n: n, exists: map[uint64]bool{}, out: make([][]int, n), in: make([]int, n), followed: make([]bool, n)}
+	for i, count := range followersCounts {
+		g.followed[i] = count > 0
+	}
+	if n < 2 {
+		return g, nil
+	}
+
+	population := max(float64(n) / *scaleFactor, 2)
+	top := min(*hubReach*(population-1), float64(n-1))
+	rank := max(int(math.Round(*scaleFactor)), 1)
+	in := scaleDegrees(followersCounts, top, rank)
+	out := scaleDegrees(followingCounts, top, rank)
+	sumIn, sumOut := sum(in), sum(out)
+	if sumIn == 0 || sumOut == 0 {
+		return g, nil
+	}
+
+	// both ends of every edge are drawn, so aim for the mean of the two totals
+	g.targetE = int(math.Round((sumIn + sumOut) / 2))
+	if maxEdges := n * (n - 1); g.targetE > maxEdges {
+		g.targetE = maxEdges
+	}
+	g.inCum = cumulative(in)
+	g.outCum = cumulative(out)
+	return g, nil
+}
+
+// scaleDegrees scales counts down so that the rank-th largest becomes top, a
+// positive count stays at least 1.
+func scaleDegrees(counts []int, top float64, rank int) []float64 {
+	sorted := append([]int(nil), counts...)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	largest := sorted[min(rank, len(sorted))-1]
+	scale := 1.0
+	if float64(largest) > top {
+		scale = top / float64(largest)
+	}
+	degrees := make([]float64, len(counts))
+	for i, count := range counts {
+		if count > 0 {
+			degrees[i] = max(float64(count)*scale, 1)
+		}
+	}
+	return degrees
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func cumulative(weights []float64) []float64 {
+	cum := make([]float64, len(weights))
+	total := 0.0
+	for i, weight := range weights {
+		total += weight
+		cum[i] = total
+	}
+	return cum
+}
+
+// draw picks an index with probability proportional to its weight.
+func (g *followGraph) draw(cum []float64) int {
+	x := g.rng.Float64() * cum[len(cum)-1]
+	return sort.SearchFloat64s(cum, x)
+}
+
+func (g *followGraph) key(from, to int) uint64 {
+	return uint64(from)*uint64(g.n) + uint64(to)
+}
+
+func (g *followGraph) add(from, to int) bool {
+	if from == to || g.exists[g.key(from, to)] {
+		return false
+	}
+	g.exists[g.key(from, to)] = true
+	g.edges = append(g.edges, follow{from: from, to: to})
+	g.out[from] = append(g.out[from], to)
+	g.in[to]++
+	return true
+}
+
+// generate draws follows until the target number of edges is reached. With
+// probability --clustering the followed account is a followee of a followee,
+// closing a triangle, and with probability --reciprocity a new follow is
+// followed back. Draws hitting an existing follow are retried, a bounded
+// number of times so that dense small populations terminate. Finally every
+// followed user still without a follower gets one.
+func (g *followGraph) generate() []follow {
+	for attempts := 0; len(g.edges) < g.targetE && attempts < 20*g.targetE; attempts++ {
+		from := g.draw(g.outCum)
+
+		to := -1
+		if len(g.out[from]) > 0 && g.rng.Float64() < *clustering {
+			via := g.out[from][g.rng.Intn(len(g.out[from]))]
+			if len(g.out[via]) > 0 {
+				to = g.out[via][g.rng.Intn(len(g.out[via]))]
+			}
+		}
+		if to < 0 {
+			to = g.draw(g.inCum)
+		}
+
+		if !g.add(from, to) {
+			continue
+		}
+		if len(g.edges) < g.targetE && g.rng.Float64() < *reciprocity {
+			g.add(to, from)
+		}
+	}
+
+	if g.n < 2 {
+		return g.edges
+	}
+	for to, followed := range g.followed {
+		for attempts := 0; followed && g.in[to] == 0; attempts++ {
+			// the follower is drawn by following count, or uniformly when that
+			// keeps hitting to itself or there are no following counts
+			if attempts < 20 && len(g.outCum) > 0 {
+				g.add(g.draw(g.outCum), to)
+			} else {
+				g.add(g.rng.Intn(g.n), to)
+			}
+		}
+	}
+	return g.edges
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func TestFollowGraphFollowsEveryFollowedUser(t *testing.T) {
+	tests := []struct {
+		name      string
+		followers []int
+		following []int
+	}{
+		{
+			name:      "one hub",
+			followers: append([]int{5000000}, repeat(1, 199)...),
+			following: repeat(300, 200),
+		},
+		{
+			name:      "heavy tail",
+			followers: heavyTail(500),
+			following: heavyTail(500),
+		},
+		{
+			name:      "no following counts",
+			followers: append([]int{100000, 0, 0}, repeat(2, 47)...),
+			following: repeat(0, 50),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(1); seed <= 5; seed++ {
+				g, err := newFollowGraph(stageRand(seed, "followers"), tt.followers, tt.following)
+				if err != nil {
+					t.Fatal(err)
+				}
+				in := make([]int, len(tt.followers))
+				for _, edge := range g.generate() {
+					if edge.from == edge.to {
+						t.Fatalf("seed %d: user %d follows itself", seed, edge.from)
+					}
+					in[edge.to]++
+				}
+				for i, count := range tt.followers {
+					if count > 0 && in[i] == 0 {
+						t.Fatalf("seed %d: user %d has %d scraped followers but no follower", seed, i, count)
+					}
+				}
+			}
+		})
+	}
+}
+
+func repeat(value, n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = value
+	}
+	return values
+}
+
+// heavyTail is a power law of counts, the i-th largest about 1e7/i^2.
+func heavyTail(n int) []int {
+	values := make([]int, n)
+	for i := range values {
+		values[i] = 10000000 / ((i + 1) * (i + 1))
+	}
+	return values
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+)
+
+// ids assigns the bigint ids of locations, posts, post_images, highlights,
+// hash_tags and comments before the rows are written, so that a stage knows
+// the ids of the rows it creates without reading them back. Users, businesses,
+// stories and the activity rows get uuids from newUUID.
+var ids *idAllocator
+
+// idAllocator hands out the ids of a run per table, counting on from the
+// highest id the table had when the run first allocated one. That base is
+// stored with the run, so a resumed run assigns the same ids again to the rows
+// it regenerates. Once the run ends the identity sequences are moved past the
+// assigned ids with setval.
+type idAllocator struct {
+	mu        sync.Mutex
+	run       *loadRun
+	sequences map[string]*idSequence
+}
+
+// idSequence is the ids of one table.
+type idSequence struct {
+	mu   sync.Mutex
+	last int64
+	used bool
+}
+
+// newIDAllocator allocates the ids of run. Without a run, as for an ingest,
+// the ids count on from the highest id in the database, or from 1 when the
+// run writes files.
+func newIDAllocator(run *loadRun) *idAllocator {
+	return &idAllocator{run: run, sequences: map[string]*idSequence{}}
+}
+
+// sequence returns the ids of table.
+func (a *idAllocator) sequence(ctx context.Context, table string) (*idSequence, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if s, ok := a.sequences[table]; ok {
+		return s, nil
+	}
+
+	base := int64(0)
+	if a.run != nil {
+		var ok bool
+		base, ok = a.run.IDBases[table]
+		if !ok {
+			var err error
+			if base, err = maxID(ctx, table); err != nil {
+				return nil, err
+			}
+			if err := a.run.saveIDBase(ctx, table, base); err != nil {
+				return nil, err
+			}
+		}
+	} else if fileOutput == nil {
+		var err error
+		if base, err = maxID(ctx, table); err != nil {
+			return nil, err
+		}
+	}
+
+	s := &idSequence{last: base}
+	a.sequences[table] = s
+	return s, nil
+}
+
+func maxID(ctx context.Context, table string) (int64, error) {
+	var id int64
+	err := rawDB.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(max(id), 0) FROM %s", quoteIdentifier(table))).Scan(&id)
+	return id, err
+}
+
+func (s *idSequence) next() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.last++
+	s.used = true
+	return s.last
+}
+
+// identities returns the last assigned id of every table that got one.
+func (a *idAllocator) identities() []identity {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	result := []identity{}
+	for table, s := range a.sequences {
+		s.mu.Lock()
+		if s.used {
+			result = append(result, identity{table: table, column: "id", last: s.last})
+		}
+		s.mu.Unlock()
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].table < result[j].table })
+	return result
+}
+
+// advance moves the identity sequences past the assigned ids, never back.
+// comments.id is a plain bigint without a sequence.
+func (a *idAllocator) advance(ctx context.Context) error {
+	for _, ident := range a.identities() {
+		_, err := rawDB.ExecContext(ctx, `SELECT setval(seq, greatest($2::bigint, COALESCE(pg_sequence_last_value(seq::regclass), 0)))
+FROM pg_get_serial_sequence($1, 'id') AS seq WHERE seq IS NOT NULL`, quoteIdentifier(ident.table), ident.last)
+		if err != nil {
+			return fmt.Errorf("advancing the id sequence of %s: %w", ident.table, err)
+		}
+	}
+	return nil
+}
+
+// saveIDBase stores the base of table with the run before any of its ids is
+// written.
+func (r *loadRun) saveIDBase(ctx context.Context, table string, base int64) error {
+	if r.IDBases == nil {
+		r.IDBases = map[string]int64{}
+	}
+	r.IDBases[table] = base
+	bases, err := json.Marshal(r.IDBases)
+	if err != nil {
+		return err
+	}
+	err = db.WithContext(ctx).Exec("UPDATE loader_runs SET id_bases = ? WHERE id = ?", string(bases), r.ID).Error
+	if err != nil {
+		return fmt.Errorf("recording the id base of %s: %w", table, err)
+	}
+	log.Printf("run %d assigns %s ids after %d", r.ID, table, base)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	"data-loader/models"
+)
+
+func TestIDAllocatorResumesFromRunBases(t *testing.T) {
+	run := &loadRun{LoaderRun: models.LoaderRun{ID: 3, IDBases: map[string]int64{"posts": 500, "comments": 0}}}
+	a := newIDAllocator(run)
+	ctx := context.Background()
+
+	posts, err := a.sequence(ctx, "posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := posts.next(); got != 501 {
+		t.Errorf("first post id %d, want 501 after the base of the run", got)
+	}
+	again, err := a.sequence(ctx, "posts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != posts || again.next() != 502 {
+		t.Errorf("a second sequence of posts does not continue the first")
+	}
+	if _, err := a.sequence(ctx, "comments"); err != nil {
+		t.Fatal(err)
+	}
+
+	// comments got a sequence but no id, so only posts needs advancing
+	want := []identity{{table: "posts", column: "id", last: 502}}
+	if got := a.identities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("identities %v, want %v", got, want)
+	}
+}
+
+func TestIDAllocatorForFilesStartsAtOne(t *testing.T) {
+	output := fileOutput
+	fileOutput = &fileSink{}
+	t.Cleanup(func() { fileOutput = output })
+
+	a := newIDAllocator(nil)
+	tables := []string{"posts", "locations", "hash_tags"}
+	for _, table := range tables {
+		s, err := a.sequence(context.Background(), table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.next(); got != 1 {
+			t.Errorf("first %s id %d, want 1", table, got)
+		}
+	}
+
+	want := []identity{
+		{table: "hash_tags", column: "id", last: 1},
+		{table: "locations", column: "id", last: 1},
+		{table: "posts", column: "id", last: 1},
+	}
+	if got := a.identities(); !reflect.DeepEqual(got, want) {
+		t.Errorf("identities %v, want them sorted by table: %v", got, want)
+	}
+}
+
+func TestIDSequenceIsUniqueAcrossGoroutines(t *testing.T) {
+	s := &idSequence{last: 10}
+	const workers, perWorker = 8, 1000
+
+	var mu sync.Mutex
+	seen := map[int64]bool{}
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				id := s.next()
+				mu.Lock()
+				seen[id] = true
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != workers*perWorker {
+		t.Errorf("%d distinct ids, want %d", len(seen), workers*perWorker)
+	}
+	for id := int64(11); id <= 10+workers*perWorker; id++ {
+		if !seen[id] {
+			t.Fatalf("id %d was skipped", id)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"data-loader/models"
+)
+
+type ingestCounts struct {
+	Inserted  int
+	Updated   int
+	Unchanged int
+}
+
+// ingestReport counts what an ingest did per table, in the order the tables were merged.
+type ingestReport struct {
+	tables []string
+	counts map[string]*ingestCounts
+}
+
+func newIngestReport() *ingestReport {
+	return &ingestReport{counts: map[string]*ingestCounts{}}
+}
+
+func (r *ingestReport) table(name string) *ingestCounts {
+	counts, ok := r.counts[name]
+	if !ok {
+		counts = &ingestCounts{}
+		r.counts[name] = counts
+		r.tables = append(r.tables, name)
+	}
+	return counts
+}
+
+func (r *ingestReport) print(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "TABLE\tINSERTED\tUPDATED\tUNCHANGED\t")
+	for _, name := range r.tables {
+		counts := r.counts[name]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", name, counts.Inserted, counts.Updated, counts.Unchanged)
+	}
+	return w.Flush()
+}
+
+func runIngest(args []string) error {
+	fs := newFlagSet("ingest", "ingest [--dry-run] <dump.json>")
+	dryRun := fs.Bool("dry-run", false, "only report what the ingest would change")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	dump := fs.Arg(0)
+	if _, err := os.Stat(dump); err != nil {
+		return err
+	}
+
+	if err := openDatabase(); err != nil {
+		return err
+	}
+
+	seed, seeded := resolveSeed()
+	reference, err := resolveNow(seeded)
+	if err != nil {
+		return err
+	}
+	setClock(reference)
+	log.Printf("seed %d", seed)
+
+	if err := checkDataset(dump); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	ids = newIDAllocator(nil)
+	report := newIngestReport()
+	err = ingest(ctx, stageRand(seed, "ingest"), dump, report, *dryRun)
+	if *dryRun {
+		fmt.Println("dry run, nothing was written")
+	} else if advanceErr := ids.advance(context.Background()); advanceErr != nil {
+		if err != nil {
+			log.Print(advanceErr)
+		} else {
+			err = advanceErr
+		}
+	}
+	report.print(os.Stdout)
+	return err
+}
+
+// ingest merges a new profile dump into a database loaded before. Users are
+// matched by username, posts by url, locations and hashtags by name: new rows
+// are inserted, changed profiles, posts and locations are updated and new posts
+// are attached to their existing or new author. Every step compares against the
+// database, so an ingest that failed can simply be run again. The dump is
+// streamed once per table instead of being held in memory.
+func ingest(ctx context.Context, rng *rand.Rand, dump string, report *ingestReport, dryRun bool) error {
+	if err := ingestLocations(ctx, dump, report.table("locations"), dryRun); err != nil {
+		return fmt.Errorf("locations: %w", err)
+	}
+	if err := ingestHashTags(ctx, dump, report.table("hash_tags"), dryRun); err != nil {
+		return fmt.Errorf("hash_tags: %w", err)
+	}
+	if err := ingestUsers(ctx, rng, dump, report.table("users"), report.table("businesses"), dryRun); err != nil {
+		return fmt.Errorf("users: %w", err)
+	}
+	if err := ingestPosts(ctx, rng, dump, report.table("posts"), report.table("post_tags"), dryRun); err != nil {
+		return fmt.Errorf("posts: %w", err)
+	}
+	return nil
+}
+
+func ingestLocations(ctx context.Context, dump string, counts *ingestCounts, dryRun bool) error {
+	var existing []*models.Location
+	if err := db.WithContext(ctx).Model(&models.Location{}).Scan(&existing).Error; err != nil {
+		return err
+	}
+	byName := map[string]*models.Location{}
+	for _, location := range existing {
+		byName[location.Name] = location
+	}
+
+	newLocations := []*models.Location{}
+	seen := map[string]bool{}
+	err := forEachValidProfile(dump, func(data Data) error {
+		for _, post := range data.Posts {
+			if post.Location == nil || seen[post.Location.Name] {
+				continue
+			}
+			seen[post.Location.Name] = true
+
+			current, ok := byName[post.Location.Name]
+			switch {
+			case !ok:
+				newLocations = append(newLocations, &models.Location{
+					HasPublicPage: post.Location.HasPublicPage,
+					Name:          post.Location.Name,
+					Slug:          post.Location.Slug,
+				})
+			case current.HasPublicPage != post.Location.HasPublicPage || current.Slug != post.Location.Slug:
+				counts.Updated++
+				if dryRun {
+					continue
+				}
+				err := db.WithContext(ctx).Model(&models.Location{}).Where("id = ?", current.ID).
+					Updates(map[string]interface{}{"has_public_page": post.Location.HasPublicPage, "slug": post.Location.Slug}).Error
+				if err != nil {
+					return err
+				}
+			default:
+				counts.Unchanged++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts.Inserted = len(newLocations)
+	if dryRun {
+		return nil
+	}
+	return insertInBatches(ctx, "locations", newLocations)
+}
+
+func ingestHashTags(ctx context.Context, dump string, counts *ingestCounts, dryRun bool) error {
+	var existing []string
+	if err := db.WithContext(ctx).Model(&models.HashTag{}).Pluck("name", &existing).Error; err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, name := range existing {
+		seen[name] = true
+	}
+
+	newTags := []*models.HashTag{}
+	inDump := map[string]bool{}
+	err := forEachValidProfile(dump, func(data Data) error {
+		for _, tag := range data.PostHashtags {
+			if inDump[tag] {
+				continue
+			}
+			inDump[tag] = true
+			if seen[tag] {
+				counts.Unchanged++
+				continue
+			}
+			newTags = append(newTags, &models.HashTag{Name: tag})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts.Inserted = len(newTags)
+	if dryRun {
+		return nil
+	}
+	return insertInBatches(ctx, "hash_tags", newTags)
+}
+
+// userChanges returns the profile columns of user that differ from data, with
+// updated_at when there are any. following_count and followers_count are left
+// out, the followers stage counts them from the generated graph.
+func userChanges(user *models.User, data Data) map[string]interface{} {
+	changes := map[string]interface{}{}
+	compare := func(column string, current, next interface{}) {
+		if current != next {
+			changes[column] = next
+		}
+	}
+	compare("bio", user.Bio, data.Biography)
+	compare("posts_count", user.PostsCount, data.PostsCount)
+	compare("highlights_count", user.HighlightsCount, data.HighlightsCount)
+	compare("name", user.Name, data.ProfileName)
+	compare("profile_image_link", user.ProfileImageLink, data.ProfileImageLink)
+	compare("is_business", user.IsBusiness, data.IsBusinessAccount)
+	compare("is_verified", user.IsVerified, data.IsVerified)
+	compare("country", user.Country, data.CountryCode)
+	compare("region", user.Region, data.Region)
+	if len(changes) > 0 {
+		changes["updated_at"] = clock()
+	}
+	return changes
+}
+
+func ingestUsers(ctx context.Context, rng *rand.Rand, dump string, counts, businessCounts *ingestCounts, dryRun bool) error {
+	var existing []*models.User
+	if err := db.WithContext(ctx).Model(&models.User{}).Scan(&existing).Error; err != nil {
+		return err
+	}
+	byUsername := map[string]*models.User{}
+	for _, user := range existing {
+		byUsername[user.Username] = user
+	}
+
+	newUsers := []*models.User{}
+	newBusinesses := []*models.Business{}
+	seen := map[string]bool{}
+	err := forEachValidProfile(dump, func(data Data) error {
+		if seen[data.Account] {
+			return nil
+		}
+		seen[data.Account] = true
+
+		current, ok := byUsername[data.Account]
+		if !ok {
+			user := newUser(rng, data)
+			newUsers = append(newUsers, user)
+			if data.IsBusinessAccount {
+				newBusinesses = append(newBusinesses, newBusiness(rng, data, user.ID))
+			}
+			return nil
+		}
+
+		changes := userChanges(current, data)
+		if len(changes) == 0 {
+			counts.Unchanged++
+			return nil
+		}
+		counts.Updated++
+		if dryRun {
+			return nil
+		}
+		err := withRetries(ctx, func() error {
+			return db.WithContext(ctx).Model(&models.User{}).Where("id = ?", current.ID).Updates(changes).Error
+		})
+		if err != nil {
+			return fmt.Errorf("updating %s: %w", data.Account, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts.Inserted = len(newUsers)
+	businessCounts.Inserted = len(newBusinesses)
+	if dryRun {
+		return nil
+	}
+	if err := insertInBatches(ctx, "users", newUsers); err != nil {
+		return err
+	}
+	return insertInBatches(ctx, "businesses", newBusinesses)
+}
+
+func ingestPosts(ctx context.Context, rng *rand.Rand, dump string, counts, tagCounts *ingestCounts, dryRun bool) error {
+	var existing []*models.Post
+	err := db.WithContext(ctx).Model(&models.Post{}).Select("id", "url", "caption").Scan(&existing).Error
+	if err != nil {
+		return err
+	}
+	byURL := map[string]*models.Post{}
+	for _, post := range existing {
+		byURL[post.URL] = post
+	}
+
+	userIDs, err := lookupUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+	locationIDs, err := lookupLocationIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	var tags []*models.HashTag
+	if err := db.WithContext(ctx).Model(&models.HashTag{}).Select("id", "name").Order("id").Scan(&tags).Error; err != nil {
+		return err
+	}
+
+	sponsors, err := loadSponsorships(ctx, rng)
+	if err != nil {
+		return err
+	}
+
+	var postIDs *idSequence
+	if !dryRun {
+		if postIDs, err = ids.sequence(ctx, "posts"); err != nil {
+			return err
+		}
+	}
+
+	newPosts := []*models.Post{}
+	err = forEachValidProfile(dump, func(data Data) error {
+		for _, postData := range data.Posts {
+			if current, ok := byURL[postData.Url]; ok {
+				if err := updatePost(ctx, current, postData, counts, dryRun); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if dryRun {
+				// new users and locations have no id before they are written
+				newPosts = append(newPosts, &models.Post{Caption: postData.Caption})
+				continue
+			}
+			post, err := newPost(postData, userIDs[data.Account], locationIDs)
+			if err != nil {
+				return err
+			}
+			id := postIDs.next()
+			post.ID = &id
+			sponsors.apply(post, locationName(postData))
+			newPosts = append(newPosts, post)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	counts.Inserted = len(newPosts)
+	if !dryRun {
+		if err := insertInBatches(ctx, "posts", newPosts); err != nil {
+			return err
+		}
+	}
+
+	// tag the new posts the same way the post-tags stage does
+	postTags := []*models.PostTag{}
+	for _, post := range newPosts {
+		for _, tag := range tags {
+			if strings.Contains(post.Caption, tag.Name) {
+				postTag := &models.PostTag{TagID: tag.ID}
+				if post.ID != nil {
+					postTag.PostID = *post.ID
+				}
+				postTags = append(postTags, postTag)
+			}
+		}
+	}
+
+	tagCounts.Inserted = len(postTags)
+	if dryRun {
+		return nil
+	}
+	return insertInBatches(ctx, "post_tags", postTags)
+}
+
+// postChanges returns the columns of post that differ from postData, with
+// updated_at when there are any. likes_count and comments_count are left out,
+// they count the generated likes and comments.
+func postChanges(post *models.Post, postData DataPost) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if post.Caption != postData.Caption {
+		changes["caption"] = postData.Caption
+	}
+	if len(changes) > 0 {
+		changes["updated_at"] = clock()
+	}
+	return changes
+}
+
+// updatePost updates a post that was ingested before from postData, when it
+// changed.
+func updatePost(ctx context.Context, post *models.Post, postData DataPost, counts *ingestCounts, dryRun bool) error {
+	changes := postChanges(post, postData)
+	if len(changes) == 0 {
+		counts.Unchanged++
+		return nil
+	}
+	counts.Updated++
+	if dryRun {
+		return nil
+	}
+	err := withRetries(ctx, func() error {
+		return db.WithContext(ctx).Model(&models.Post{}).Where("id = ?", *post.ID).Updates(changes).Error
+	})
+	if err != nil {
+		return fmt.Errorf("updating %s: %w", postData.Url, err)
+	}
+	return nil
+}
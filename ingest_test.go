@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestIngestChanges(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	setClock(&now)
+	t.Cleanup(func() { setClock(nil) })
+
+	user := &models.User{
+		Username:         "alice",
+		Bio:              "hello",
+		Name:             "Alice",
+		ProfileImageLink: "https://example.com/alice.jpg",
+		FollowersCount:   12,
+		FollowingCount:   3,
+		PostsCount:       2,
+		Country:          "US",
+	}
+	profile := func(change func(*Data)) Data {
+		data := Data{
+			Account:          "alice",
+			Biography:        "hello",
+			ProfileName:      "Alice",
+			ProfileImageLink: "https://example.com/alice.jpg",
+			Followers:        12,
+			Following:        3,
+			PostsCount:       2,
+			CountryCode:      "US",
+		}
+		change(&data)
+		return data
+	}
+	postID := int64(1)
+	post := &models.Post{ID: &postID, Caption: "sunset", LikesCount: 4, CommentsCount: 2}
+	postData := func(change func(*DataPost)) DataPost {
+		data := DataPost{Caption: "sunset", Likes: 4, Comments: 2}
+		change(&data)
+		return data
+	}
+
+	tests := []struct {
+		name    string
+		changes map[string]interface{}
+		want    []string
+	}{
+		{name: "unchanged user", changes: userChanges(user, profile(func(*Data) {}))},
+		{
+			name:    "changed profile",
+			changes: userChanges(user, profile(func(d *Data) { d.Biography, d.IsVerified = "bye", true })),
+			want:    []string{"bio", "is_verified", "updated_at"},
+		},
+		{
+			name:    "scraped follow counts are not compared",
+			changes: userChanges(user, profile(func(d *Data) { d.Followers, d.Following = 500, 40 })),
+		},
+		{
+			name:    "posts count",
+			changes: userChanges(user, profile(func(d *Data) { d.PostsCount = 3 })),
+			want:    []string{"posts_count", "updated_at"},
+		},
+		{name: "unchanged post", changes: postChanges(post, postData(func(*DataPost) {}))},
+		{
+			name:    "changed caption",
+			changes: postChanges(post, postData(func(p *DataPost) { p.Caption = "sunrise" })),
+			want:    []string{"caption", "updated_at"},
+		},
+		{
+			name:    "scraped likes and comments are not compared",
+			changes: postChanges(post, postData(func(p *DataPost) { p.Likes, p.Comments = 90, 30 })),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for column := range tt.changes {
+				got = append(got, column)
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("changed %v, want %v", got, tt.want)
+			}
+			if at, ok := tt.changes["updated_at"]; ok && at != now {
+				t.Errorf("updated_at %v, want %v", at, now)
+			}
+		})
+	}
+}
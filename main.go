@@ -1,18 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"math/rand"
 	"os"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/google/uuid"
 	_ "github.com/lib/pq"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -20,71 +20,20 @@ import (
 	"data-loader/models"
 )
 
-func init() {
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname='%s' sslmode=disable", "localhost", "5432", "SYS", "instaadmin", "")
+func connect(cfg Config) error {
 	var err error
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{NowFunc: func() time.Time { return clock() }})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	rawDB, err = db.DB()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-}
-
-type Data struct {
-	Account             string `json:"account,omitempty"`
-	Biography           string `json:"biography,omitempty"`
-	BusinessAddressJson struct {
-		CityName      string  `json:"city_name,omitempty"`
-		CityId        int64   `json:"city_id,omitempty"`
-		Latitude      float64 `json:"latitude,omitempty"`
-		Longitude     float64 `json:"longitude,omitempty"`
-		StreetAddress string  `json:"street_address,omitempty"`
-		ZipCode       string  `json:"zip_code,omitempty"`
-	} `json:"business_address_json,omitempty"`
-	BusinessCategoryName string `json:"business_category_name,omitempty"`
-	BusinessEmail        string `json:"business_email,omitempty"`
-	ExternalUrl          string `json:"external_url,omitempty"`
-	Fbid                 string `json:"fbid,omitempty"`
-	Followers            int64  `json:"followers,omitempty"`
-	Following            int64  `json:"following,omitempty"`
-	Highlights           []struct {
-		Id    string `json:"id,omitempty"`
-		Title string `json:"title,omitempty"`
-		Image string `json:"image,omitempty"`
-		Owner string `json:"owner,omitempty"`
-	} `json:"highlights,omitempty"`
-	Id                    string `json:"id,omitempty"`
-	IsBusinessAccount     bool   `json:"is_business_account,omitempty"`
-	IsProfessionalAccount bool   `json:"is_professional_account,omitempty"`
-	IsVerified            bool   `json:"is_verified,omitempty"`
-	Posts                 []struct {
-		Caption  string `json:"caption,omitempty"`
-		Likes    int64  `json:"likes,omitempty"`
-		Datetime int    `json:"datetime,omitempty"`
-		ImageUrl string `json:"image_url,omitempty"`
-		Id       string `json:"id,omitempty"`
-		Location *struct {
-			Id            string `json:"id,omitempty"`
-			HasPublicPage bool   `json:"has_public_page,omitempty"`
-			Name          string `json:"name,omitempty"`
-			Slug          string `json:"slug,omitempty"`
-		} `json:"location,omitempty"`
-		Url            string `json:"url,omitempty"`
-		Comments       int64  `json:"comments,omitempty"`
-		VideoViewCount int64  `json:"video_view_count,omitempty,omitempty"`
-		VideoUrl       string `json:"video_url,omitempty,omitempty"`
-	} `json:"posts,omitempty"`
-	PostsCount       int64    `json:"posts_count,omitempty"`
-	ProfileImageLink string   `json:"profile_image_link,omitempty"`
-	ProfileName      string   `json:"profile_name,omitempty"`
-	HighlightsCount  int64    `json:"highlights_count,omitempty"`
-	CountryCode      string   `json:"country_code,omitempty"`
-	Region           string   `json:"region,omitempty"`
-	AvgEngagement    float64  `json:"avg_engagement,omitempty"`
-	PostHashtags     []string `json:"post_hashtags,omitempty"`
+	rawDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	rawDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	rawDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	return nil
 }
 
 var (
@@ -93,230 +42,65 @@ var (
 )
 
 func main() {
+	flag.Usage = usage
+	flag.Parse()
 
-	file, err := os.ReadFile("instagram_profiles_Github Hashtag_dataset.json")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var collection []Data
-	err = json.Unmarshal(file, &collection)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	locations := []*models.Location{}
-	mapLocations := map[string]*models.Location{}
-	for _, data := range collection {
-		for _, post := range data.Posts {
-			if post.Location != nil {
-				if _, ok := mapLocations[post.Location.Name]; !ok {
-					elems := &models.Location{
-						HasPublicPage: post.Location.HasPublicPage,
-						Name:          post.Location.Name,
-						Slug:          post.Location.Slug,
-					}
-					locations = append(locations, elems)
-					mapLocations[post.Location.Name] = elems
-				}
-			}
-		}
-	}
-
-	users := []*models.User{}
-	businesss := []*models.Business{}
-	posts := []*models.Post{}
-	tags := []*models.HashTag{}
-
-	postCaption := map[*int64]string{}
-	hashTags := map[string]*int64{}
-	allTags := []string{}
-	highlights := []*models.Highlight{}
-	highlightSet := map[string]*models.Highlight{}
-	for _, data := range collection {
-		userID := uuid.NewString()
-		user := &models.User{
-			ID:               userID,
-			Username:         data.Account,
-			FollowingCount:   data.Following,
-			FollowersCount:   data.Followers,
-			Bio:              data.Biography,
-			PostsCount:       data.PostsCount,
-			HighlightsCount:  data.HighlightsCount,
-			Name:             data.ProfileName,
-			ProfileImageLink: data.ProfileImageLink,
-			IsBusiness:       data.IsBusinessAccount,
-			IsVerified:       data.IsVerified,
-			Country:          data.CountryCode,
-			Region:           data.Region,
-		}
-		users = append(users, user)
-		if data.IsBusinessAccount {
-			atoi, _ := strconv.Atoi(data.BusinessAddressJson.ZipCode)
-			business := &models.Business{
-				ID:            uuid.NewString(),
-				CityName:      data.BusinessAddressJson.CityName,
-				Latitude:      data.BusinessAddressJson.Latitude,
-				Longitude:     data.BusinessAddressJson.Longitude,
-				StreetAddress: data.BusinessAddressJson.StreetAddress,
-				ZipCode:       atoi,
-				UserID:        userID,
-			}
-			businesss = append(businesss, business)
-		}
-
-		allTags = append(allTags, data.PostHashtags...)
-
-		for _, postData := range data.Posts {
-			elems := &models.Post{
-				UserID:          userID,
-				Caption:         postData.Caption,
-				LikesCount:      postData.Likes,
-				CommentsCount:   postData.Comments,
-				VideoViewCount:  postData.VideoViewCount,
-				PrimaryImageURL: postData.ImageUrl,
-				PrimaryVideoURL: postData.VideoUrl,
-				URL:             postData.Url,
-			}
-			if postData.Location != nil {
-				elems.LocationID = &mapLocations[postData.Location.Name].ID
-				elems.IsSponsored = postData.Location.Name == "Sponsered"
-			}
-			posts = append(posts, elems)
-		}
-
-		for _, highlight := range data.Highlights {
-			highlightSet[fmt.Sprintf("%s_%s", userID, highlight.Title)] = &models.Highlight{
-				UserID: userID,
-				Title:  highlight.Title,
-				Image:  highlight.Image,
-			}
-		}
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	for _, v := range highlightSet {
-		highlights = append(highlights, v)
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
 	}
 
-	tagSet := map[string]bool{}
-	for _, tag := range allTags {
-		tagSet[tag] = true
-	}
-
-	allTags = []string{}
-	for tag, _ := range tagSet {
-		elems := &models.HashTag{
-			Name: tag,
-		}
-		tags = append(tags, elems)
-		hashTags[tag] = &elems.ID
-		allTags = append(allTags, tag)
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		log.Fatal(err)
 	}
+}
 
-	wg := &sync.WaitGroup{}
-
-	wg.Add(2)
-
-	createUser(users)
-	go createBusiness(businesss, wg)
-	go createLocations(locations, wg)
-
-	wg.Wait()
-	wg.Add(2)
-	go createPosts(posts, wg)
-
-	for _, post := range posts {
-		postCaption[post.ID] = post.Caption
+// openDatabase resolves the connection settings and connects db and rawDB.
+func openDatabase() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
 	}
-	go createHashTags(tags, wg)
-
-	wg.Wait()
-
-	wg.Add(3)
-
-	postTags := []*models.PostTag{}
-	go createPostTagsConcurrently(postTags, allTags, postCaption, hashTags, wg)
-
-	go createHighlights(highlights, wg)
-
-	go createFollowers(wg)
-
-	wg.Wait()
-
-	wg.Add(3)
-
-	go createComments(wg)
-
-	go createPostLikes(wg)
-
-	go createPostImages(wg)
-
-	wg.Wait()
-
-	wg.Add(2)
-
-	go createCommentLikes(wg)
-
-	go createStories(wg)
-
-	wg.Wait()
-
-	wg.Add(2)
-
-	go createStoryTags(wg)
-
-	//createStoryViews()
-
-	go createHighlightStories(wg)
-
-	wg.Wait()
+	log.Printf("database settings: %s", cfg)
+	return connect(cfg)
 }
 
-func createHighlightStories(wg *sync.WaitGroup) {
-	defer wg.Done()
-	type storyData struct {
-		UserID  string          `json:"user_id"`
-		Stories json.RawMessage `json:"stories"`
-	}
-	var storiesJson []storyData
-	err := db.Table("stories as s").Select("json_agg(json_build_object('id', s.id, 'user_id', s.user_id , 'media_url', s.media_url, 'created_at', s.created_at, 'updated_at', s.updated_at, 'deleted_at', s.deleted_at )) AS stories", "s.user_id").Group("s.user_id").Scan(&storiesJson).Error
+func createHighlightStories(ctx context.Context, rng *rand.Rand) error {
+	stories, err := loadTable[models.Story](ctx, "stories", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
 	storyByUser := map[string][]models.Story{}
-	for _, story := range storiesJson {
-		var userStories []models.Story
-		err := json.Unmarshal(story.Stories, &userStories)
-		if err != nil {
-			log.Fatal(err)
-		}
-		storyByUser[story.UserID] = userStories
+	for _, story := range stories {
+		storyByUser[story.UserID] = append(storyByUser[story.UserID], story)
 	}
 
-	type highlightsData struct {
-		UserID     string          `json:"user_id"`
-		Highlights json.RawMessage `json:"highlights"`
-	}
-	var hData []highlightsData
-	err = db.Table("highlights as h").Select("json_agg(h.id) as highlights", "h.user_id").Group("h.user_id").Scan(&hData).Error
+	highlights, err := loadTable[models.Highlight](ctx, "highlights", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
 	userHighlights := map[string][]int64{}
-	for _, data := range hData {
-		var ids []int64
-		err := json.Unmarshal(data.Highlights, &ids)
-		if err != nil {
-			log.Fatal(err)
-		}
-		userHighlights[data.UserID] = ids
+	for _, highlight := range highlights {
+		userHighlights[highlight.UserID] = append(userHighlights[highlight.UserID], highlight.ID)
+	}
+
+	userIDs := make([]string, 0, len(userHighlights))
+	for userID := range userHighlights {
+		userIDs = append(userIDs, userID)
 	}
+	sort.Strings(userIDs)
 
 	allHighlightStories := []models.HighlightsStory{}
 
-	for userID, highLights := range userHighlights {
+	for _, userID := range userIDs {
+		highLights := userHighlights[userID]
 		stories := storyByUser[userID]
 
 		// Calculate the maximum number of stories that can be added to highlights
@@ -326,101 +110,102 @@ func createHighlightStories(wg *sync.WaitGroup) {
 		}
 
 		// Randomly generate a number of stories to add to highlights
-		numStories := rand.Intn(maxStories + 1)
+		numStories := rng.Intn(maxStories + 1)
 
 		// Add the selected stories to highlights
 		for i := 0; i < numStories && i < len(stories) && i < len(highLights); i++ {
 			allHighlightStories = append(allHighlightStories, models.HighlightsStory{
 				HighlightID: highLights[i],
 				StoryID:     stories[i].ID,
+				CreatedAt:   timeAfter(rng, stories[i].CreatedAt, *activityWindow),
 			})
 		}
 	}
 
-	err = db.CreateInBatches(allHighlightStories, 10000).Error
+	err = insertInBatches(ctx, "highlights_stories", allHighlightStories)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Println("Highlights stories created!")
+	return nil
 }
 
-func createStoryViews() {
-	var stories []models.Story
-	err := db.Model(&models.Story{}).Scan(&stories).Error
-	if err != nil {
-		log.Fatal(err)
+// createStoryViews lets every follower of the author view a story with a
+// probability drawn per story around --view-rate, and like it with
+// probability --story-like-rate. Views happen within 24 hours of the story and
+// after the viewer started following.
+func createStoryViews(ctx context.Context, rng *rand.Rand) error {
+	if err := validateRates(map[string]float64{"view-rate": *viewRate, "story-like-rate": *storyLikeRate}); err != nil {
+		return err
 	}
 
-	numbers := getRandomNumbers(int64(len(stories)), 300)
-
-	type Followers struct {
-		UserID    string          `json:"user_id"`
-		Followers json.RawMessage `json:"followers"`
-	}
-	var userFollowers []Followers
-	err = db.Table("users as u").Select("u.id AS user_id", "json_agg(follower_id) AS followers").Joins("LEFT JOIN followers f ON u.id = f.following_id").Group("u.id").Scan(&userFollowers).Error
+	follows, err := loadFollows(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	followers := followersOf(follows)
 
-	userXFollowers := map[string][]string{}
-	for _, user := range userFollowers {
-		var followers []string
-		err := json.Unmarshal(user.Followers, &followers)
-		if err != nil {
-			log.Fatal(err)
-		}
-		userXFollowers[user.UserID] = followers
+	stories, err := loadTable[models.Story](ctx, "stories", "id")
+	if err != nil {
+		return err
 	}
 
-	var storyViews []models.StoryView
-	for i := 0; i < len(numbers); i++ {
-		followers := userXFollowers[stories[i].UserID]
-		for j, viewerID := range followers[:numbers[i]] {
-			storyViews = append(storyViews, models.StoryView{
-				StoryID:  stories[i].ID,
-				ViewerID: viewerID,
-				IsLiked: func() bool {
-					return j%2 == 0
-				}(),
+	storyViews, err := newBatchWriter[*models.StoryView](ctx, "story_views")
+	if err != nil {
+		return err
+	}
+	for _, story := range stories {
+		rate := *viewRate + rng.NormFloat64()**viewRateSpread
+		expires := story.CreatedAt.Add(24 * time.Hour)
+		for _, follow := range followers[story.UserID] {
+			if rng.Float64() >= rate || !follow.FollowedAt.Before(expires) {
+				continue
+			}
+			start := latest(story.CreatedAt, follow.FollowedAt)
+			err := storyViews.Add(&models.StoryView{
+				StoryID:  story.ID,
+				ViewerID: follow.FollowerID,
+				IsLiked:  rng.Float64() < *storyLikeRate,
+				ViewedAt: timeAfter(rng, start, expires.Sub(start)),
 			})
+			if err != nil {
+				return err
+			}
 		}
 	}
 
-	err = db.CreateInBatches(storyViews, 10000).Error
-	if err != nil {
-		log.Fatal(err)
+	if err := storyViews.Close(); err != nil {
+		return err
 	}
 
 	log.Println("successfully created story views!")
+	return nil
 }
 
-func createStoryTags(wg *sync.WaitGroup) {
-	defer wg.Done()
-	var tags []models.HashTag
-	err := db.Model(&models.HashTag{}).Scan(&tags).Error
+func createStoryTags(ctx context.Context, rng *rand.Rand) error {
+	tags, err := loadTable[models.HashTag](ctx, "hash_tags", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	var stories []models.Story
-	err = db.Model(&models.Story{}).Scan(&stories).Error
+	stories, err := loadTable[models.Story](ctx, "stories", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	numbers := getRandomNumbers(int64(len(stories)), 3)
+	numbers := getRandomNumbers(rng, int64(len(stories)), 3)
 
 	allStoryTags := []models.StoryTag{}
 	storyTags := map[string]models.StoryTag{}
 	for i := 0; i < len(numbers); i++ {
 		number := numbers[i]
-		randomNumbers := getRandomNumbers(int64(number), number)
+		randomNumbers := getRandomNumbers(rng, int64(number), number)
 		for _, tagIndex := range randomNumbers {
 			storyTags[fmt.Sprintf("%s_%d", stories[i].ID, tags[tagIndex].ID)] = models.StoryTag{
-				StoryID: stories[i].ID,
-				TagID:   tags[tagIndex].ID,
+				StoryID:   stories[i].ID,
+				TagID:     tags[tagIndex].ID,
+				CreatedAt: stories[i].CreatedAt,
 			}
 		}
 	}
@@ -428,297 +213,277 @@ func createStoryTags(wg *sync.WaitGroup) {
 	for _, storyTag := range storyTags {
 		allStoryTags = append(allStoryTags, storyTag)
 	}
+	sort.Slice(allStoryTags, func(i, j int) bool {
+		if allStoryTags[i].StoryID != allStoryTags[j].StoryID {
+			return allStoryTags[i].StoryID < allStoryTags[j].StoryID
+		}
+		return allStoryTags[i].TagID < allStoryTags[j].TagID
+	})
 
-	err = db.CreateInBatches(allStoryTags, 10000).Error
+	err = insertInBatches(ctx, "story_tags", allStoryTags)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Println("Story tags created successfully!")
+	return nil
 }
 
-func createStories(wg *sync.WaitGroup) {
-	defer wg.Done()
-	fileBytes, err := os.Open("stories.json")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var storiesData []*models.Story
-	err = json.NewDecoder(fileBytes).Decode(&storiesData)
+func createStories(ctx context.Context, rng *rand.Rand) error {
+	storiesData, err := openInput[*models.Story]("stories")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer storiesData.Close()
 
-	var users []*models.User
-	err = db.Model(&models.User{}).Scan(&users).Error
+	users, err := loadTable[*models.User](ctx, "users", "username")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	usersCount := int64(len(users))
-	numbers := getRandomNumbers(usersCount, 100)
+	numbers := getRandomNumbers(rng, usersCount, 100)
 
-	allStories := []*models.Story{}
-	start := int64(0)
+	allStories, err := newBulkWriter[*models.Story](ctx, "stories")
+	if err != nil {
+		return err
+	}
 	for i := int64(0); i < usersCount; i++ {
 		storyCount := int64(numbers[i])
 		if users[i].HighlightsCount > storyCount {
 			storyCount = users[i].HighlightsCount
 		}
-		stories := storiesData[start : start+storyCount]
-		for j, story := range stories {
-			story.ID = uuid.NewString()
+		stories, err := takeRecords(storiesData, int(storyCount))
+		if err != nil {
+			return fmt.Errorf("stories for user %d of %d: %w", i+1, usersCount, err)
+		}
+		start := latest(users[i].CreatedAt, clock().Add(-*storyWindow))
+		for _, story := range stories {
+			story.ID = newUUID(rng)
 			story.UserID = users[i].ID
-			stories[j] = story
+			story.CreatedAt = timeAfter(rng, start, *storyWindow)
+			if err := allStories.Add(story); err != nil {
+				return err
+			}
 		}
-
-		allStories = append(allStories, stories...)
-		start = start + storyCount
 	}
 
-	err = db.CreateInBatches(allStories, 10000).Error
-	if err != nil {
-		log.Fatal(err)
+	if err := allStories.Close(); err != nil {
+		return err
 	}
 
 	log.Println("Stories created successfully")
+	return nil
 }
 
-func createPostImages(wg *sync.WaitGroup) {
-	defer wg.Done()
-	fileBytes, err := os.Open("post_images.json")
+func createPostImages(ctx context.Context, rng *rand.Rand) error {
+	postImagesData, err := openInput[*models.PostImage]("post_images")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	defer postImagesData.Close()
 
-	var postImagesData []*models.PostImage
-	err = json.NewDecoder(fileBytes).Decode(&postImagesData)
+	posts, err := loadTable[*models.Post](ctx, "posts", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	var postCount int64
-	err = db.Model(&models.Post{}).Select("count(*) as post_count").Scan(&postCount).Error
+	imageIDs, err := ids.sequence(ctx, "post_images")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	var posts []*models.Post
-	err = db.Model(&models.Post{}).Scan(&posts).Error
+	postCount := int64(len(posts))
+	allPostImages, err := newBulkWriter[*models.PostImage](ctx, "post_images")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	var allPostImages []*models.PostImage
-	start := 0
-	postImagesCount := getRandomNumbers(postCount, 10)
+	postImagesCount := getRandomNumbers(rng, postCount, 10)
 	for i := int64(0); i < postCount; i++ {
-		singlePostImageCount := postImagesCount[i]
-		images := postImagesData[start : start+singlePostImageCount]
-		for i, image := range images {
-			image.PostOrder = i + 1
+		images, err := takeRecords(postImagesData, postImagesCount[i])
+		if err != nil {
+			return fmt.Errorf("images for post %d of %d: %w", i+1, postCount, err)
+		}
+		for order, image := range images {
+			image.ID = imageIDs.next()
+			image.PostOrder = order + 1
 			image.PostID = *posts[i].ID
-			images[i] = image
+			image.CreatedAt = posts[i].CreatedAt
+			if err := allPostImages.Add(image); err != nil {
+				return err
+			}
 		}
-		allPostImages = append(allPostImages, images...)
-		start = start + singlePostImageCount
 	}
 
-	err = db.CreateInBatches(allPostImages, 9300).Error
-	if err != nil {
-		log.Fatal(err)
+	if err := allPostImages.Close(); err != nil {
+		return err
 	}
 
 	log.Println("Post images created")
+	return nil
 }
 
-func createCommentLikes(wg *sync.WaitGroup) {
-	defer wg.Done()
-	type CommentSchema struct {
-		ID              int64  `json:"id"`
-		PostID          int64  `json:"post_id"`
-		UserID          string `json:"user_id"`
-		ParentCommentID int64  `json:"parent_comment_id"`
-		PostAuthorID    string `json:"post_author_id"`
-	}
-	var comments []*CommentSchema
-	err := db.Table("comments c").Select("c.id", "c.post_id", "c.user_id", "c.parent_comment_id", "p.user_id as post_author_id").Joins("inner join posts p on p.id = c.post_id").Scan(&comments).Error
+func createCommentLikes(ctx context.Context, rng *rand.Rand) error {
+	comments, err := loadTable[models.Comment](ctx, "comments", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	type Followers struct {
-		UserID    string          `json:"user_id"`
-		Followers json.RawMessage `json:"followers"`
-	}
-	var userFollowers []Followers
-	err = db.Table("users as u").Select("u.id AS user_id", "json_agg(follower_id) AS followers").Joins("LEFT JOIN followers f ON u.id = f.following_id").Group("u.id").Scan(&userFollowers).Error
+	posts, err := loadTable[models.Post](ctx, "posts", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	postAuthor := map[int64]string{}
+	for _, post := range posts {
+		postAuthor[*post.ID] = post.UserID
 	}
 
-	userXFollowers := map[string][]string{}
-	for _, user := range userFollowers {
-		var followers []string
-		err := json.Unmarshal(user.Followers, &followers)
-		if err != nil {
-			log.Fatal(err)
-		}
-		userXFollowers[user.UserID] = followers
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
 	}
+	userXFollowers := followersOf(follows)
 
-	randomNumbers := getRandomNumbers(int64(len(comments)), 200)
+	randomNumbers := getRandomNumbers(rng, int64(len(comments)), 200)
 
 	commentLikes := []*models.CommentLike{}
 	for i, comment := range comments {
 		noOfLikes := randomNumbers[i]
-		for j := 0; j < noOfLikes; j++ {
+		followers := userXFollowers[postAuthor[comment.PostID]]
+		for j := 0; j < noOfLikes && j < len(followers); j++ {
 			commentLikes = append(commentLikes, &models.CommentLike{
 				CommentID: comment.ID,
-				LikedBy:   userXFollowers[comment.PostAuthorID][j],
+				LikedBy:   followers[j].FollowerID,
+				LikedAt:   timeAfter(rng, comment.CreatedAt, *activityWindow),
 			})
 		}
 	}
 
-	err = db.CreateInBatches(commentLikes, 10000).Error
+	err = bulkInsert(ctx, "comment_likes", commentLikes)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Println("Comment likes generated")
+	return nil
 }
 
-func getRandomNumbers(size int64, maxValue int) []int {
-	rand.Seed(time.Now().UnixNano())
-
+func getRandomNumbers(rng *rand.Rand, size int64, maxValue int) []int {
 	// Create an array to store the random numbers
 	randomNumbers := make([]int, size)
 
 	// Generate random numbers and store them in the array
 	for i := int64(0); i < size; i++ {
-		randomNumbers[i] = rand.Intn(maxValue) + 1 // Generates a random number between 1 and 200
+		randomNumbers[i] = rng.Intn(maxValue) + 1 // Generates a random number between 1 and 200
 	}
 
 	return randomNumbers
 }
 
-func createPostLikes(wg *sync.WaitGroup) {
-	wg.Done()
-	var posts []*models.Post
-	err := db.Model(&models.Post{}).Select("id", "likes_count", "user_id").Where("likes_count > 0").Scan(&posts).Error
+func createPostLikes(ctx context.Context, rng *rand.Rand) error {
+	posts, err := loadTable[*models.Post](ctx, "posts", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
 	}
+	followers := followersOf(follows)
 
 	var likes []*models.PostLikes
 	for _, post := range posts {
-		var followingUsers []models.Follower
-		err := db.Model(&models.Follower{}).Select("follower_id").Where("following_id = ?", post.UserID).Scan(&followingUsers).Error
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		selectedUsers := []models.Follower{}
-		if int64(len(followingUsers)) > post.LikesCount {
-			selectedUsers = followingUsers[:post.LikesCount]
+		if post.LikesCount <= 0 {
+			continue
 		}
+		followingUsers := followers[post.UserID]
+		selectedUsers := followingUsers[:min(int64(len(followingUsers)), post.LikesCount)]
 
 		for _, user := range selectedUsers {
 			likes = append(likes, &models.PostLikes{
-				PostID: *post.ID,
-				UserID: user.FollowerID,
+				PostID:  *post.ID,
+				UserID:  user.FollowerID,
+				LikedAt: timeAfter(rng, post.CreatedAt, *activityWindow),
 			})
 		}
 	}
 
-	err = db.CreateInBatches(likes, 10000).Error
+	err = bulkInsert(ctx, "post_likes", likes)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	_, err = rawDB.Exec(`UPDATE posts AS p
+	if fileOutput != nil {
+		// the files get likes_count when the run is complete
+		log.Println("Post likes successfully created")
+		return nil
+	}
+
+	err = withRetries(ctx, func() error {
+		_, err := rawDB.ExecContext(ctx, `UPDATE posts AS p
 	SET likes_count = (
 		SELECT COUNT(*)
 		FROM post_likes AS pl
 		WHERE pl.post_id = p.id
 	)`)
+		return err
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Println("Post likes successfully created")
+	return nil
 }
 
-func createFollowers(wg *sync.WaitGroup) {
-	defer wg.Done()
-	// Query for user IDs and their follower and following counts
-	rows, err := rawDB.Query("SELECT id, following_count, followers_count FROM users")
+func createFollowers(ctx context.Context, rng *rand.Rand) error {
+	users, err := loadTable[models.User](ctx, "users", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer rows.Close()
-
-	type User struct {
-		UserID         string
-		FollowingCount int
-		FollowersCount int
+	// the scraped counts are the target degrees of the graph
+	followersCounts := make([]int, len(users))
+	followingCounts := make([]int, len(users))
+	for i, user := range users {
+		followersCounts[i] = int(user.FollowersCount)
+		followingCounts[i] = int(user.FollowingCount)
 	}
-
-	users := []User{}
-	followers := []*models.Follower{}
-
-	// Iterate through each user and randomly generate follower relationships
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.UserID, &user.FollowingCount, &user.FollowersCount); err != nil {
-			log.Fatal(err)
-		}
-		users = append(users, user)
+	graph, err := newFollowGraph(rng, followersCounts, followingCounts)
+	if err != nil {
+		return err
 	}
+	edges := graph.generate()
 
-	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+	followers, err := newBulkWriter[*models.Follower](ctx, "followers")
+	if err != nil {
+		return err
 	}
-
-	followersMap := map[string]bool{}
-
-	for _, user := range users {
-		// Generate follower relationships based on following and followers count
-		followingIDs := generateRandomUserIDs(user.UserID, user.FollowingCount, rawDB, false)
-		for _, id := range followingIDs {
-			key := fmt.Sprintf("%s_%s", user.UserID, id)
-			if _, ok := followersMap[key]; !ok {
-				followersMap[key] = true
-				follower := &models.Follower{
-					FollowerID:  user.UserID,
-					FollowingID: id,
-				}
-				followers = append(followers, follower)
-			}
-		}
-
-		followersIDs := generateRandomUserIDs(user.UserID, user.FollowersCount, rawDB, false)
-		for _, id := range followersIDs {
-			key := fmt.Sprintf("%s_%s", id, user.UserID)
-			if _, ok := followersMap[key]; !ok {
-				followersMap[key] = true
-				follower := &models.Follower{
-					FollowerID:  id,
-					FollowingID: user.UserID,
-				}
-				followers = append(followers, follower)
-			}
+	for _, edge := range edges {
+		follower, following := users[edge.from], users[edge.to]
+		// a follow happens any time after both accounts exist
+		start := latest(follower.CreatedAt, following.CreatedAt)
+		err := followers.Add(&models.Follower{
+			FollowerID:  follower.ID,
+			FollowingID: following.ID,
+			FollowedAt:  timeAfter(rng, start, clock().Sub(start)),
+		})
+		if err != nil {
+			return err
 		}
 	}
+	if err := followers.Close(); err != nil {
+		return err
+	}
 
-	tx := db.CreateInBatches(followers, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+	if fileOutput != nil {
+		// the files get the counters when the run is complete
+		fmt.Println("Follower relationships have been generated successfully!")
+		return nil
 	}
 
-	tx = db.Raw(`UPDATE users AS u
+	// the scraped counts were only targets, the counters follow the graph
+	tx := db.WithContext(ctx).Exec(`UPDATE users AS u
 SET
     following_count = (
         SELECT COUNT(*)
@@ -732,162 +497,327 @@ SET
     )`)
 
 	if tx.Error != nil {
-		log.Fatal(tx.Error)
+		return tx.Error
 	}
 
 	fmt.Println("Follower relationships have been generated successfully!")
+	return nil
 }
 
-func createComments(wg *sync.WaitGroup) {
-	defer wg.Done()
-	var commentsStore []*models.Comment
-	file, err := os.Open("comments.json")
-	if err != nil {
-		log.Fatal(err)
+func createComments(ctx context.Context, rng *rand.Rand) error {
+	if err := validateThreading(); err != nil {
+		return err
+	}
+	if err := validateText(); err != nil {
+		return err
 	}
-	defer file.Close()
 
-	err = json.NewDecoder(file).Decode(&commentsStore)
+	corpus, err := loadCommentCorpus()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	var totalComments int
-	err = db.Model(&models.Post{}).Select("sum(comments_count) as total_comments").Scan(&totalComments).Error
+	posts, err := loadTable[models.Post](ctx, "posts", "id")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	requiredComments := commentsStore[:totalComments]
-
-	var posts []models.Post
-	tx := db.Model(&models.Post{}).Select("comments_count", "id", "user_id").Where("comments_count > 0").Scan(&posts)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+	users, err := loadTable[*models.User](ctx, "users", "id")
+	if err != nil {
+		return err
+	}
+	usersByID := map[string]*models.User{}
+	userIDs := make([]string, len(users))
+	for i, user := range users {
+		usersByID[user.ID] = user
+		userIDs[i] = user.ID
+	}
+	hashTags, err := loadTable[*models.HashTag](ctx, "hash_tags", "id")
+	if err != nil {
+		return err
+	}
+	tags := make([]string, len(hashTags))
+	for i, tag := range hashTags {
+		tags[i] = tag.Name
 	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+	followers := followersOf(follows)
 
-	finalComments := []*models.Comment{}
+	commentIDs, err := ids.sequence(ctx, "comments")
+	if err != nil {
+		return err
+	}
 
-	postComments := map[int64][]*models.Comment{}
-	start := int64(0)
-	counter := int64(1)
+	finalComments, err := newBulkWriter[*models.Comment](ctx, "comments")
+	if err != nil {
+		return err
+	}
 	for _, post := range posts {
-		var followingUsers []models.Follower
-		err := db.Model(&models.Follower{}).Select("follower_id").Where("following_id = ?", post.UserID).Scan(&followingUsers).Error
-		if err != nil {
-			log.Fatal(err)
+		if post.CommentsCount <= 0 {
+			continue
+		}
+		// the comments of an author without followers come from random users
+		commenters := userIDs
+		if followingUsers := followers[post.UserID]; len(followingUsers) > 0 {
+			commenters = make([]string, len(followingUsers))
+			for i, follow := range followingUsers {
+				commenters[i] = follow.FollowerID
+			}
 		}
-		selectedComments := requiredComments[start : start+post.CommentsCount]
-		for i, comment := range selectedComments {
-			rand.Seed(time.Now().UnixNano())
-			index := rand.Intn(len(followingUsers))
-			comment.UserID = followingUsers[index].FollowerID
-			comment.PostID = *post.ID
-			selectedComments[i] = comment
-			comment.ID = counter
-			counter = counter + 1
+		selectedComments := make([]*models.Comment, post.CommentsCount)
+		for i := range selectedComments {
+			selectedComments[i] = &models.Comment{
+				ID:     commentIDs.next(),
+				PostID: *post.ID,
+				UserID: commenters[rng.Intn(len(commenters))],
+			}
 		}
+		threadComments(rng, post, selectedComments)
+
+		// a reply mentions the author of its parent, a top-level comment
+		// another commenter of the post
+		byID := map[int64]*models.Comment{}
+		for _, comment := range selectedComments {
+			byID[comment.ID] = comment
+			mentioned := commenters[rng.Intn(len(commenters))]
+			if comment.ParentCommentID != nil {
+				mentioned = byID[*comment.ParentCommentID].UserID
+			}
+			mentions := []string{usersByID[mentioned].Username}
+			if mentioned == comment.UserID {
+				mentions = nil
+			}
+			comment.CommentText = corpus.generate(rng, commentText, usersByID[comment.UserID].Country, mentions, tags)
+		}
+		for _, comment := range selectedComments {
+			if err := finalComments.Add(comment); err != nil {
+				return err
+			}
+		}
+	}
 
-		postComments[*post.ID] = selectedComments
-		finalComments = append(finalComments, selectedComments...)
-		start = start + post.CommentsCount
+	if err := finalComments.Close(); err != nil {
+		return err
 	}
 
-	for _, v := range postComments {
-		fillParentCommentID(v)
+	log.Println("Comments successfully loaded")
+	return nil
+}
+
+func createUser(ctx context.Context, rng *rand.Rand) error {
+	users, err := newBatchWriter[*models.User](ctx, "users", userConflict()...)
+	if err != nil {
+		return err
+	}
+	err = forEachProfile(func(data Data) error {
+		return users.Add(newUser(rng, data))
+	})
+	if err != nil {
+		return err
 	}
+	return users.Close()
+}
 
-	tx = db.CreateInBatches(finalComments, 8190)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+func createBusiness(ctx context.Context, rng *rand.Rand) error {
+	userIDs, err := lookupUserIDs(ctx)
+	if err != nil {
+		return err
 	}
 
-	log.Println("Comments successfully loaded")
+	businesses, err := newBatchWriter[*models.Business](ctx, "businesses")
+	if err != nil {
+		return err
+	}
+	err = forEachProfile(func(data Data) error {
+		if !data.IsBusinessAccount {
+			return nil
+		}
+		return businesses.Add(newBusiness(rng, data, userIDs[data.Account]))
+	})
+	if err != nil {
+		return err
+	}
+	return businesses.Close()
 }
 
-// Function to generate random user IDs based on following or followers
-func generateRandomUserIDs(excludeID string, count int, db *sql.DB, includeSelf bool) []string {
-	var userIDs []string
-	var query string
-	// Exclude the current user from the random selection
-	query = fmt.Sprintf("SELECT id FROM users WHERE id != $1 ORDER BY random() LIMIT %d", count)
-	// Query for random user IDs based on the condition
-	rows, err := db.Query(query, excludeID)
+func createLocations(ctx context.Context, _ *rand.Rand) error {
+	locationIDs, err := ids.sequence(ctx, "locations")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var userID string
-		if err := rows.Scan(&userID); err != nil {
-			log.Fatal(err)
+	locations, err := newBatchWriter[*models.Location](ctx, "locations", locationConflict()...)
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	err = forEachProfile(func(data Data) error {
+		for _, post := range data.Posts {
+			if post.Location == nil || seen[post.Location.Name] {
+				continue
+			}
+			seen[post.Location.Name] = true
+			err := locations.Add(&models.Location{
+				ID:            locationIDs.next(),
+				HasPublicPage: post.Location.HasPublicPage,
+				Name:          post.Location.Name,
+				Slug:          post.Location.Slug,
+			})
+			if err != nil {
+				return err
+			}
 		}
-		userIDs = append(userIDs, userID)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
-	if err := rows.Err(); err != nil {
-		log.Fatal(err)
+	return locations.Close()
+}
+
+func createPosts(ctx context.Context, rng *rand.Rand) error {
+	userIDs, err := lookupUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+	locationIDs, err := lookupLocationIDs(ctx)
+	if err != nil {
+		return err
+	}
+	sponsors, err := loadSponsorships(ctx, rng)
+	if err != nil {
+		return err
+	}
+	postIDs, err := ids.sequence(ctx, "posts")
+	if err != nil {
+		return err
 	}
 
-	return userIDs
+	posts, err := newBatchWriter[*models.Post](ctx, "posts", postConflict()...)
+	if err != nil {
+		return err
+	}
+	err = forEachProfile(func(data Data) error {
+		for _, postData := range data.Posts {
+			post, err := newPost(postData, userIDs[data.Account], locationIDs)
+			if err != nil {
+				return err
+			}
+			id := postIDs.next()
+			post.ID = &id
+			sponsors.apply(post, locationName(postData))
+			if err := posts.Add(post); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return posts.Close()
 }
 
-func createUser(users []*models.User) {
-	tx := db.CreateInBatches(users, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+func createHashTags(ctx context.Context, _ *rand.Rand) error {
+	tagIDs, err := ids.sequence(ctx, "hash_tags")
+	if err != nil {
+		return err
 	}
-}
 
-func createBusiness(businesses []*models.Business, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tx := db.CreateInBatches(businesses, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+	tags, err := newBatchWriter[*models.HashTag](ctx, "hash_tags", hashTagConflict()...)
+	if err != nil {
+		return err
+	}
+	tagSet := map[string]bool{}
+	err = forEachProfile(func(data Data) error {
+		for _, tag := range data.PostHashtags {
+			if tagSet[tag] {
+				continue
+			}
+			tagSet[tag] = true
+			if err := tags.Add(&models.HashTag{ID: tagIDs.next(), Name: tag}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
 	}
+	return tags.Close()
 }
 
-func createLocations(locations []*models.Location, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tx := db.CreateInBatches(locations, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+func createHighlights(ctx context.Context, _ *rand.Rand) error {
+	userIDs, err := lookupUserIDs(ctx)
+	if err != nil {
+		return err
+	}
+	highlightIDs, err := ids.sequence(ctx, "highlights")
+	if err != nil {
+		return err
 	}
-}
 
-func createPosts(posts []*models.Post, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tx := db.CreateInBatches(posts, 4000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+	highlights, err := newBatchWriter[*models.Highlight](ctx, "highlights")
+	if err != nil {
+		return err
 	}
+	highlightSet := map[string]bool{}
+	err = forEachProfile(func(data Data) error {
+		userID := userIDs[data.Account]
+		for _, highlight := range data.Highlights {
+			key := fmt.Sprintf("%s_%s", userID, highlight.Title)
+			if highlightSet[key] {
+				continue
+			}
+			highlightSet[key] = true
+			err := highlights.Add(&models.Highlight{
+				ID:     highlightIDs.next(),
+				UserID: userID,
+				Title:  highlight.Title,
+				Image:  highlight.Image,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return highlights.Close()
 }
 
-func createHashTags(hashTags []*models.HashTag, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tx := db.CreateInBatches(hashTags, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
-	}
+func createPostTags(ctx context.Context, postTags []*models.PostTag) error {
+	return insertInBatches(ctx, "post_tags", postTags)
 }
 
-func createHighlights(highlights []*models.Highlight, wg *sync.WaitGroup) {
-	defer wg.Done()
-	tx := db.CreateInBatches(highlights, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+func createPostTagsConcurrently(ctx context.Context, _ *rand.Rand) error {
+	posts, err := loadTable[*models.Post](ctx, "posts", "id")
+	if err != nil {
+		return err
 	}
-}
 
-func createPostTags(postTags []*models.PostTag) {
-	tx := db.CreateInBatches(postTags, 10000)
-	if tx.Error != nil {
-		log.Fatal(tx.Error)
+	tags, err := loadTable[*models.HashTag](ctx, "hash_tags", "id")
+	if err != nil {
+		return err
+	}
+
+	postCaption := map[*int64]string{}
+	postCreatedAt := map[int64]time.Time{}
+	for _, post := range posts {
+		postCaption[post.ID] = post.Caption
+		postCreatedAt[*post.ID] = post.CreatedAt
+	}
+
+	allTags := []string{}
+	hashTags := map[string]*int64{}
+	for _, tag := range tags {
+		hashTags[tag.Name] = &tag.ID
+		allTags = append(allTags, tag.Name)
 	}
-}
 
-func createPostTagsConcurrently(postTags []*models.PostTag, allTags []string, postCaption map[*int64]string, hashTags map[string]*int64, parentWg *sync.WaitGroup) {
-	defer parentWg.Done()
 	resultCh := make(chan *models.PostTag)
 
 	var wg sync.WaitGroup
@@ -908,11 +838,48 @@ func createPostTagsConcurrently(postTags []*models.PostTag, allTags []string, po
 	}()
 
 	// Collect results from worker goroutines
+	postTags := []*models.PostTag{}
 	for postTag := range resultCh {
+		postTag.CreatedAt = postCreatedAt[postTag.PostID]
 		postTags = append(postTags, postTag)
 	}
+	// Workers finish in any order, keep the insert order stable between runs
+	sort.Slice(postTags, func(i, j int) bool {
+		if postTags[i].PostID != postTags[j].PostID {
+			return postTags[i].PostID < postTags[j].PostID
+		}
+		return postTags[i].TagID < postTags[j].TagID
+	})
+
+	return createPostTags(ctx, postTags)
+}
+
+// lookupUserIDs maps the usernames already loaded into users to their ids
+func lookupUserIDs(ctx context.Context) (map[string]string, error) {
+	users, err := loadTable[*models.User](ctx, "users", "id")
+	if err != nil {
+		return nil, err
+	}
 
-	createPostTags(postTags)
+	userIDs := map[string]string{}
+	for _, user := range users {
+		userIDs[user.Username] = user.ID
+	}
+	return userIDs, nil
+}
+
+// lookupLocationIDs maps the location names already loaded into locations to their ids
+func lookupLocationIDs(ctx context.Context) (map[string]int64, error) {
+	locations, err := loadTable[*models.Location](ctx, "locations", "id")
+	if err != nil {
+		return nil, err
+	}
+
+	locationIDs := map[string]int64{}
+	for _, location := range locations {
+		locationIDs[location.Name] = location.ID
+	}
+	return locationIDs, nil
 }
 
 // Worker function to process tags concurrently
@@ -926,16 +893,3 @@ func worker(tag string, postCaption map[*int64]string, hashTags map[string]*int6
 		}
 	}
 }
-
-// Function to fill in parent_comment_id for comments based on a binary tree structure
-func fillParentCommentID(comments []*models.Comment) {
-	// Shuffle comment IDs
-	rand.Shuffle(len(comments), func(i, j int) {
-		comments[i], comments[j] = comments[j], comments[i]
-	})
-
-	// Build parent_comment_id based on shuffled IDs
-	for i := 1; i < len(comments); i++ {
-		comments[i].ParentCommentID = comments[(i-1)/2].ID
-	}
-}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestCreateStoryViews(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		viewRate      float64
+		storyLikeRate float64
+		wantErr       string
+	}{
+		{name: "everyone views and likes", viewRate: 1, storyLikeRate: 1},
+		{name: "defaults", viewRate: 0.3, storyLikeRate: 0.1},
+		{name: "nobody views", viewRate: 0, storyLikeRate: 0.1},
+		{name: "view rate above 1", viewRate: 1.5, storyLikeRate: 0.1, wantErr: "--view-rate"},
+		{name: "negative like rate", viewRate: 0.3, storyLikeRate: -0.1, wantErr: "--story-like-rate"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			view, spread, like := *viewRate, *viewRateSpread, *storyLikeRate
+			*viewRate, *viewRateSpread, *storyLikeRate = tt.viewRate, 0, tt.storyLikeRate
+			t.Cleanup(func() { *viewRate, *viewRateSpread, *storyLikeRate = view, spread, like })
+
+			sink := useFileOutput(t, now)
+			ctx := context.Background()
+
+			// the followers of alice follow her one day apart, the last one a
+			// day before the reference time
+			followedAt := map[string]time.Time{}
+			follows := []*models.Follower{}
+			for i := 0; i < 5; i++ {
+				follower := fmt.Sprintf("follower-%d", i)
+				followedAt[follower] = now.AddDate(0, 0, -5+i)
+				follows = append(follows, &models.Follower{FollowerID: follower, FollowingID: "alice", FollowedAt: followedAt[follower]})
+			}
+			stories := []*models.Story{
+				{ID: "old", UserID: "alice", CreatedAt: now.AddDate(0, 0, -3)},
+				{ID: "recent", UserID: "alice", CreatedAt: now.Add(-time.Hour)},
+				{ID: "unfollowed", UserID: "bob", CreatedAt: now.AddDate(0, 0, -2)},
+			}
+			created := map[string]time.Time{}
+			for _, story := range stories {
+				created[story.ID] = story.CreatedAt
+			}
+			if err := sink.write(ctx, "followers", follows, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := sink.write(ctx, "stories", stories, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			err := createStoryViews(ctx, stageRand(1, "story-views"))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want one about %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			views, err := loadTable[*models.StoryView](ctx, "story_views", "story_id, viewer_id")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			liked := 0
+			for _, view := range views {
+				followed, ok := followedAt[view.ViewerID]
+				if !ok || view.StoryID == "unfollowed" {
+					t.Errorf("%s viewed story %s without following its author", view.ViewerID, view.StoryID)
+					continue
+				}
+				expires := created[view.StoryID].Add(24 * time.Hour)
+				if view.ViewedAt.Before(created[view.StoryID]) || view.ViewedAt.Before(followed) || view.ViewedAt.After(expires) || view.ViewedAt.After(now) {
+					t.Errorf("%s viewed story %s at %v, before following at %v or outside its day", view.ViewerID, view.StoryID, view.ViewedAt, followed)
+				}
+				if view.IsLiked {
+					liked++
+				}
+			}
+			// three followers followed before the old story expired, all
+			// five before the recent one
+			if tt.viewRate == 1 && len(views) != 3+5 {
+				t.Errorf("%d views, want 8 with a view rate of 1", len(views))
+			}
+			if tt.viewRate == 0 && len(views) != 0 {
+				t.Errorf("%d views, want none with a view rate of 0", len(views))
+			}
+			if tt.storyLikeRate == 1 && liked != len(views) {
+				t.Errorf("%d of %d views liked, want all", liked, len(views))
+			}
+		})
+	}
+}
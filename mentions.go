@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"regexp"
+	"strings"
+
+	"data-loader/models"
+)
+
+var (
+	imageTagRate    = flag.Float64("image-tag-rate", 0.2, "fraction of the post images with tagged users")
+	maxImageTags    = flag.Int("max-image-tags", 3, "maximum number of users tagged in a post image")
+	followerTagBias = flag.Float64("follower-tag-bias", 0.8, "probability that a user tagged in a post image is a follower of the author rather than any user")
+)
+
+// mentionPattern matches an @username: letters, digits, periods and
+// underscores, not preceded by a character of a username or an email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w.@])@([\w.]{1,30})`)
+
+// mentionedUsers returns the ids of the users mentioned in text, once each in
+// the order of their first mention. Usernames are case insensitive and never
+// end with a period.
+func mentionedUsers(text string, userIDs map[string]string) []string {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		userID, ok := userIDs[strings.ToLower(strings.TrimRight(match[1], "."))]
+		if ok && !seen[userID] {
+			seen[userID] = true
+			result = append(result, userID)
+		}
+	}
+	return result
+}
+
+func createMentions(ctx context.Context, _ *rand.Rand) error {
+	users, err := loadTable[*models.User](ctx, "users", "id")
+	if err != nil {
+		return err
+	}
+	userIDs := map[string]string{}
+	for _, user := range users {
+		userIDs[strings.ToLower(user.Username)] = user.ID
+	}
+
+	posts, err := loadTable[*models.Post](ctx, "posts", "id")
+	if err != nil {
+		return err
+	}
+	postMentions, err := newBatchWriter[*models.PostMention](ctx, "post_mentions")
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		for _, userID := range mentionedUsers(post.Caption, userIDs) {
+			err := postMentions.Add(&models.PostMention{PostID: *post.ID, MentionedUserID: userID, CreatedAt: post.CreatedAt})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := postMentions.Close(); err != nil {
+		return err
+	}
+
+	comments, err := loadTable[*models.Comment](ctx, "comments", "id")
+	if err != nil {
+		return err
+	}
+	commentMentions, err := newBulkWriter[*models.CommentMention](ctx, "comment_mentions")
+	if err != nil {
+		return err
+	}
+	for _, comment := range comments {
+		for _, userID := range mentionedUsers(comment.CommentText, userIDs) {
+			err := commentMentions.Add(&models.CommentMention{CommentID: comment.ID, MentionedUserID: userID, CreatedAt: comment.CreatedAt})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := commentMentions.Close(); err != nil {
+		return err
+	}
+
+	log.Println("Mentions created")
+	return nil
+}
+
+// createPostImageUserTags tags users in --image-tag-rate of the post images,
+// mostly followers of the post author, at random positions away from the
+// edges of the image.
+func createPostImageUserTags(ctx context.Context, rng *rand.Rand) error {
+	if err := validateRates(map[string]float64{"image-tag-rate": *imageTagRate, "follower-tag-bias": *followerTagBias}); err != nil {
+		return err
+	}
+	if *maxImageTags < 1 {
+		return fmt.Errorf("invalid --max-image-tags %d, expected 1 or more", *maxImageTags)
+	}
+
+	accounts, err := loadAccounts(ctx)
+	if err != nil {
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+	followers := followersOf(follows)
+	posts, err := loadTable[models.Post](ctx, "posts", "id")
+	if err != nil {
+		return err
+	}
+	authors := map[int64]string{}
+	for _, post := range posts {
+		authors[*post.ID] = post.UserID
+	}
+	images, err := loadTable[models.PostImage](ctx, "post_images", "id")
+	if err != nil {
+		return err
+	}
+
+	userTags, err := newBulkWriter[*models.PostImageUserTag](ctx, "post_image_user_tags")
+	if err != nil {
+		return err
+	}
+	for _, image := range images {
+		if len(accounts) < 2 || rng.Float64() >= *imageTagRate {
+			continue
+		}
+		author := authors[image.PostID]
+		tagged := map[string]bool{author: true}
+		n := 1 + rng.Intn(*maxImageTags)
+		for tries := 0; len(tagged) <= n && tries < 4*n; tries++ {
+			userID := accounts[rng.Intn(len(accounts))].ID
+			if candidates := followers[author]; len(candidates) > 0 && rng.Float64() < *followerTagBias {
+				userID = candidates[rng.Intn(len(candidates))].FollowerID
+			}
+			if tagged[userID] {
+				continue
+			}
+			tagged[userID] = true
+			err := userTags.Add(&models.PostImageUserTag{
+				PostImageID: image.ID,
+				UserID:      userID,
+				X:           0.1 + 0.8*rng.Float64(),
+				Y:           0.1 + 0.8*rng.Float64(),
+				CreatedAt:   image.CreatedAt,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := userTags.Close(); err != nil {
+		return err
+	}
+
+	log.Println("Post image user tags created")
+	return nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMentionedUsers(t *testing.T) {
+	userIDs := map[string]string{
+		"alice":       "1",
+		"bob":         "2",
+		"carol.smith": "3",
+		"me":          "4",
+		"example.com": "5",
+		"dan_99":      "6",
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{name: "no mention", text: "great picture", want: []string{}},
+		{name: "one mention", text: "@alice look at this", want: []string{"1"}},
+		{name: "case insensitive", text: "hi @ALICE and @Bob", want: []string{"1", "2"}},
+		{name: "order of first mention", text: "@bob @alice @bob", want: []string{"2", "1"}},
+		{name: "username with period", text: "with @carol.smith today", want: []string{"3"}},
+		{name: "trailing period", text: "thanks @bob.", want: []string{"2"}},
+		{name: "trailing periods", text: "thanks @carol.smith...", want: []string{"3"}},
+		{name: "underscore and digits", text: "cc @dan_99!", want: []string{"6"}},
+		{name: "email address", text: "write to me@example.com", want: []string{}},
+		{name: "email address and mention", text: "me@example.com or @me", want: []string{"4"}},
+		{name: "inside a word", text: "bob@alice", want: []string{}},
+		{name: "after a period", text: "see.@alice", want: []string{}},
+		{name: "double at", text: "@@alice", want: []string{}},
+		{name: "in parentheses", text: "(@alice)", want: []string{"1"}},
+		{name: "on a new line", text: "hello\n@alice", want: []string{"1"}},
+		{name: "unknown user", text: "@nobody and @alice", want: []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mentionedUsers(tt.text, userIDs)
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("mentionedUsers(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"data-loader/models"
+)
+
+var (
+	conversationRate        = flag.Float64("conversation-rate", 0.3, "fraction of the pairs of mutual followers with a direct conversation")
+	messageRequestRate      = flag.Float64("message-request-rate", 0.1, "direct conversations between users that are not mutual followers, as a fraction of those between mutual followers")
+	groupRate               = flag.Float64("group-rate", 0.02, "fraction of the users that start a group conversation with their mutual followers")
+	maxGroupSize            = flag.Int("max-group-size", 8, "maximum number of participants of a group conversation, at least 3")
+	messagesPerConversation = flag.Float64("messages-per-conversation", 12, "mean number of messages of a conversation")
+	shareRate               = flag.Float64("share-rate", 0.1, "fraction of the messages sharing a post of an account the sender follows")
+	readRate                = flag.Float64("read-rate", 0.8, "fraction of the participants that have read every message of a conversation")
+	reactionRate            = flag.Float64("reaction-rate", 0.1, "fraction of the read messages a recipient reacts to")
+)
+
+var reactions = []string{"❤️", "😂", "😮", "😢", "😡", "👍"}
+
+var groupTitles = []string{"Weekend plans", "Family", "Besties", "Trip planning", "Game night", "Study group", "Birthday surprise", "Gym buddies"}
+
+func validateMessaging() error {
+	rates := map[string]float64{
+		"conversation-rate": *conversationRate, "message-request-rate": *messageRequestRate, "group-rate": *groupRate,
+		"share-rate": *shareRate, "read-rate": *readRate, "reaction-rate": *reactionRate,
+	}
+	if err := validateRates(rates); err != nil {
+		return err
+	}
+	if *maxGroupSize < 3 {
+		return fmt.Errorf("invalid --max-group-size %d, expected 3 or more", *maxGroupSize)
+	}
+	if *messagesPerConversation < 1 {
+		return fmt.Errorf("invalid --messages-per-conversation %v, expected 1 or more", *messagesPerConversation)
+	}
+	return nil
+}
+
+// inbox collects the rows of the direct messages, written table by table
+// once every conversation is generated.
+type inbox struct {
+	rng             *rand.Rand
+	corpus          *textCorpus
+	users           map[string]*models.User
+	following       map[string][]string
+	posts           map[string][]models.Post
+	conversationIDs *idSequence
+	messageIDs      *idSequence
+
+	conversations []*models.Conversation
+	participants  []*models.ConversationParticipant
+	messages      []*models.Message
+	reactions     []*models.MessageReaction
+}
+
+// createMessages starts direct conversations between --conversation-rate of
+// the mutual followers and, as message requests, between some users that are
+// not mutual followers, and group conversations of --group-rate of the users
+// with their mutual followers. No conversation brings together two users of
+// which one blocked the other.
+func createMessages(ctx context.Context, rng *rand.Rand) error {
+	if err := validateMessaging(); err != nil {
+		return err
+	}
+	if err := validateText(); err != nil {
+		return err
+	}
+
+	corpus, err := loadCommentCorpus()
+	if err != nil {
+		return err
+	}
+	users, err := loadTable[*models.User](ctx, "users", "id")
+	if err != nil {
+		return err
+	}
+	follows, err := loadFollows(ctx)
+	if err != nil {
+		return err
+	}
+	blocks, err := loadTable[models.Block](ctx, "block", "user_id, blocked_id")
+	if err != nil {
+		return err
+	}
+	posts, err := loadTable[models.Post](ctx, "posts", "id")
+	if err != nil {
+		return err
+	}
+	conversationIDs, err := ids.sequence(ctx, "conversations")
+	if err != nil {
+		return err
+	}
+	messageIDs, err := ids.sequence(ctx, "messages")
+	if err != nil {
+		return err
+	}
+
+	box := &inbox{
+		rng:             rng,
+		corpus:          corpus,
+		users:           map[string]*models.User{},
+		following:       map[string][]string{},
+		posts:           map[string][]models.Post{},
+		conversationIDs: conversationIDs,
+		messageIDs:      messageIDs,
+	}
+	for _, user := range users {
+		box.users[user.ID] = user
+	}
+	followedAt := map[string]time.Time{}
+	for _, follow := range follows {
+		followedAt[pairKey(follow.FollowerID, follow.FollowingID)] = follow.FollowedAt
+		box.following[follow.FollowerID] = append(box.following[follow.FollowerID], follow.FollowingID)
+	}
+	for _, post := range posts {
+		box.posts[post.UserID] = append(box.posts[post.UserID], post)
+	}
+	blocked := map[string]bool{}
+	for _, block := range blocks {
+		blocked[pairKey(block.UserID, block.BlockedID)] = true
+		blocked[pairKey(block.BlockedID, block.UserID)] = true
+	}
+
+	// mutual followers, friends since both follow each other
+	friends := map[string][]string{}
+	friendsSince := map[string]time.Time{}
+	direct := 0
+	for _, follow := range follows {
+		a, b := follow.FollowerID, follow.FollowingID
+		back, ok := followedAt[pairKey(b, a)]
+		if !ok || a > b || blocked[pairKey(a, b)] {
+			continue
+		}
+		since := latest(follow.FollowedAt, back)
+		friends[a] = append(friends[a], b)
+		friends[b] = append(friends[b], a)
+		friendsSince[pairKey(a, b)], friendsSince[pairKey(b, a)] = since, since
+		if rng.Float64() < *conversationRate {
+			box.converse(false, a, []string{a, b}, since)
+			direct++
+		}
+	}
+
+	requests := int(math.Round(float64(direct) * *messageRequestRate))
+	for i, tries := 0, 0; i < requests && len(users) > 1 && tries < 4*requests; tries++ {
+		a, b := users[rng.Intn(len(users))], users[rng.Intn(len(users))]
+		_, ab := followedAt[pairKey(a.ID, b.ID)]
+		_, ba := followedAt[pairKey(b.ID, a.ID)]
+		if a.ID == b.ID || (ab && ba) || blocked[pairKey(a.ID, b.ID)] {
+			continue
+		}
+		box.converse(false, a.ID, []string{a.ID, b.ID}, latest(a.CreatedAt, b.CreatedAt))
+		i++
+	}
+
+	for _, user := range users {
+		candidates := friends[user.ID]
+		if len(candidates) < 2 || rng.Float64() >= *groupRate {
+			continue
+		}
+		size := 3 + rng.Intn(*maxGroupSize-2)
+		members := []string{user.ID}
+		start := user.CreatedAt
+		for tries := 0; len(members) < size && tries < 4*size; tries++ {
+			candidate := candidates[rng.Intn(len(candidates))]
+			if !canJoin(candidate, members, blocked) {
+				continue
+			}
+			members = append(members, candidate)
+			start = latest(start, friendsSince[pairKey(user.ID, candidate)])
+		}
+		if len(members) >= 3 {
+			box.converse(true, user.ID, members, start)
+		}
+	}
+
+	if err := bulkInsert(ctx, "conversations", box.conversations); err != nil {
+		return err
+	}
+	if err := bulkInsert(ctx, "messages", box.messages); err != nil {
+		return err
+	}
+	if err := bulkInsert(ctx, "conversation_participants", box.participants); err != nil {
+		return err
+	}
+	if err := bulkInsert(ctx, "message_reactions", box.reactions); err != nil {
+		return err
+	}
+
+	log.Printf("Created %d conversations with %d messages", len(box.conversations), len(box.messages))
+	return nil
+}
+
+// canJoin tells whether user can join the members of a group: they are not
+// already in it and none of them blocked or was blocked by user.
+func canJoin(user string, members []string, blocked map[string]bool) bool {
+	for _, member := range members {
+		if member == user || blocked[pairKey(member, user)] {
+			return false
+		}
+	}
+	return true
+}
+
+// converse creates a conversation of members started by creator after start,
+// with its messages, the read state of every member and their reactions.
+func (b *inbox) converse(group bool, creator string, members []string, start time.Time) {
+	rng := b.rng
+	conversation := &models.Conversation{
+		ID:        b.conversationIDs.next(),
+		IsGroup:   group,
+		CreatedBy: creator,
+		CreatedAt: since(rng, start),
+	}
+	if group {
+		title := groupTitles[rng.Intn(len(groupTitles))]
+		conversation.Title = &title
+	}
+	b.conversations = append(b.conversations, conversation)
+
+	count := 1 + int(rng.ExpFloat64()*(*messagesPerConversation-1))
+	times := make([]time.Time, count)
+	for i := range times {
+		times[i] = since(rng, conversation.CreatedAt)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	messages := make([]*models.Message, count)
+	lastOwn := map[string]int{}
+	for i, at := range times {
+		sender := members[rng.Intn(len(members))]
+		if i == 0 {
+			sender = creator
+		}
+		message := &models.Message{ID: b.messageIDs.next(), ConversationID: conversation.ID, SenderID: sender, CreatedAt: at}
+		if rng.Float64() < *shareRate {
+			if post, ok := b.sharedPost(sender, at); ok {
+				message.SharedPostID = post.ID
+			}
+		}
+		if message.SharedPostID == nil {
+			text := b.corpus.generate(rng, commentText, b.users[sender].Country, nil, nil)
+			message.Text = &text
+		}
+		messages[i] = message
+		lastOwn[sender] = i
+	}
+	conversation.LastMessageAt = &times[count-1]
+
+	// a member has read the messages before their own last one and, with the
+	// rest of the conversation, up to read[member] at readAt[member]
+	read := map[string]int{}
+	readAt := map[string]time.Time{}
+	for _, member := range members {
+		first := -1
+		if own, ok := lastOwn[member]; ok {
+			first = own
+		}
+		last := first
+		if rng.Float64() < *readRate {
+			last = count - 1
+		} else if first < count-1 {
+			last = first + rng.Intn(count-first)
+		}
+		read[member] = last
+
+		participant := &models.ConversationParticipant{ConversationID: conversation.ID, UserID: member, JoinedAt: conversation.CreatedAt}
+		if last >= 0 {
+			window := clock().Sub(times[last])
+			if last < count-1 {
+				window = times[last+1].Sub(times[last])
+			}
+			at := timeAfter(rng, times[last], window)
+			readAt[member] = at
+			participant.LastReadMessageID = &messages[last].ID
+			participant.LastReadAt = &at
+		}
+		b.participants = append(b.participants, participant)
+	}
+
+	// a message is read by a member when they send a later message, or at
+	// readAt when it is not after read
+	nextOwn := map[string]time.Time{}
+	reacted := []*models.MessageReaction{}
+	for i := count - 1; i >= 0; i-- {
+		message := messages[i]
+		var readBy time.Time
+		unread := false
+		for _, member := range members {
+			if member == message.SenderID {
+				continue
+			}
+			at, ok := nextOwn[member]
+			if !ok && i <= read[member] {
+				at, ok = readAt[member], true
+			}
+			if !ok {
+				unread = true
+				continue
+			}
+			readBy = latest(readBy, at)
+			if rng.Float64() < *reactionRate {
+				reacted = append(reacted, &models.MessageReaction{
+					MessageID: message.ID,
+					UserID:    member,
+					Reaction:  reactions[rng.Intn(len(reactions))],
+					CreatedAt: at,
+				})
+			}
+		}
+		if !unread {
+			message.ReadAt = &readBy
+		}
+		nextOwn[message.SenderID] = message.CreatedAt
+	}
+	b.messages = append(b.messages, messages...)
+	for i := len(reacted) - 1; i >= 0; i-- {
+		b.reactions = append(b.reactions, reacted[i])
+	}
+}
+
+// sharedPost picks a post of an account sender follows, posted before at.
+func (b *inbox) sharedPost(sender string, at time.Time) (models.Post, bool) {
+	following := b.following[sender]
+	if len(following) == 0 {
+		return models.Post{}, false
+	}
+	posts := b.posts[following[b.rng.Intn(len(following))]]
+	if len(posts) == 0 {
+		return models.Post{}, false
+	}
+	post := posts[b.rng.Intn(len(posts))]
+	return post, !post.CreatedAt.After(at)
+}
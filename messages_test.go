@@ -0,0 +1,169 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestCanJoin(t *testing.T) {
+	blocked := map[string]bool{pairKey("bob", "carol"): true, pairKey("carol", "bob"): true}
+
+	tests := []struct {
+		name    string
+		user    string
+		members []string
+		want    bool
+	}{
+		{name: "new member", user: "dave", members: []string{"alice", "bob"}, want: true},
+		{name: "already a member", user: "bob", members: []string{"alice", "bob"}, want: false},
+		{name: "blocked by a member", user: "carol", members: []string{"alice", "bob"}, want: false},
+		{name: "blocked a member", user: "bob", members: []string{"alice", "carol"}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canJoin(tt.user, tt.members, blocked); got != tt.want {
+				t.Errorf("canJoin(%s, %v) = %v, want %v", tt.user, tt.members, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverse(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	setClock(&now)
+	t.Cleanup(func() { setClock(nil) })
+
+	tests := []struct {
+		name      string
+		group     bool
+		members   []string
+		shareRate float64
+		readRate  float64
+	}{
+		{name: "direct", members: []string{"alice", "bob"}, shareRate: 0.1, readRate: 0.8},
+		{name: "group", group: true, members: []string{"alice", "bob", "carol", "dave"}, shareRate: 0.1, readRate: 0.8},
+		{name: "only shared posts", members: []string{"alice", "bob"}, shareRate: 1, readRate: 0.8},
+		{name: "nothing read", group: true, members: []string{"alice", "bob", "carol"}, shareRate: 0.1, readRate: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			share, read := *shareRate, *readRate
+			*shareRate, *readRate = tt.shareRate, tt.readRate
+			t.Cleanup(func() { *shareRate, *readRate = share, read })
+
+			for seed := int64(1); seed <= 5; seed++ {
+				box := testInbox(seed, now)
+				start := now.Add(-30 * 24 * time.Hour)
+				box.converse(tt.group, tt.members[0], tt.members, start)
+				checkConversation(t, seed, box, tt.group, tt.members, start)
+			}
+		})
+	}
+}
+
+// testInbox is an inbox of four users following each other, each with a post
+// made a year before now.
+func testInbox(seed int64, now time.Time) *inbox {
+	box := &inbox{
+		rng:             stageRand(seed, "messages"),
+		corpus:          newTextCorpus(stageRand(seed, "comment corpus")),
+		users:           map[string]*models.User{},
+		following:       map[string][]string{},
+		posts:           map[string][]models.Post{},
+		conversationIDs: &idSequence{},
+		messageIDs:      &idSequence{},
+	}
+	accounts := []string{"alice", "bob", "carol", "dave"}
+	for i, account := range accounts {
+		box.users[account] = &models.User{ID: account, Country: "US"}
+		postID := int64(i + 1)
+		box.posts[account] = []models.Post{{ID: &postID, UserID: account, CreatedAt: now.AddDate(-1, 0, 0)}}
+		for _, other := range accounts {
+			if other != account {
+				box.following[account] = append(box.following[account], other)
+			}
+		}
+	}
+	return box
+}
+
+// checkConversation checks that the messages of the one conversation of box
+// are sent by its members after it started, the first one by its creator,
+// and that read state and reactions follow the messages and come from the
+// other members.
+func checkConversation(t *testing.T, seed int64, box *inbox, group bool, members []string, start time.Time) {
+	t.Helper()
+	now := clock()
+	if len(box.conversations) != 1 {
+		t.Fatalf("seed %d: %d conversations, want 1", seed, len(box.conversations))
+	}
+	conversation := box.conversations[0]
+	if conversation.IsGroup != group || (conversation.Title != nil) != group {
+		t.Errorf("seed %d: group %v with title %v, want group %v", seed, conversation.IsGroup, conversation.Title, group)
+	}
+	if conversation.CreatedAt.Before(start) || conversation.CreatedAt.After(now) {
+		t.Errorf("seed %d: conversation created at %v, outside %v to %v", seed, conversation.CreatedAt, start, now)
+	}
+
+	isMember := map[string]bool{}
+	for _, member := range members {
+		isMember[member] = true
+	}
+	messages := map[int64]*models.Message{}
+	for i, message := range box.messages {
+		messages[message.ID] = message
+		if !isMember[message.SenderID] {
+			t.Errorf("seed %d: message %d sent by %s, not a member", seed, message.ID, message.SenderID)
+		}
+		if i == 0 && message.SenderID != conversation.CreatedBy {
+			t.Errorf("seed %d: first message sent by %s, want the creator %s", seed, message.SenderID, conversation.CreatedBy)
+		}
+		if message.CreatedAt.Before(conversation.CreatedAt) || message.CreatedAt.After(now) {
+			t.Errorf("seed %d: message %d sent at %v, outside the conversation", seed, message.ID, message.CreatedAt)
+		}
+		if i > 0 && message.CreatedAt.Before(box.messages[i-1].CreatedAt) {
+			t.Errorf("seed %d: message %d sent before the message preceding it", seed, message.ID)
+		}
+		if (message.Text == nil) == (message.SharedPostID == nil) {
+			t.Errorf("seed %d: message %d needs either a text or a shared post", seed, message.ID)
+		}
+		if message.ReadAt != nil && message.ReadAt.Before(message.CreatedAt) {
+			t.Errorf("seed %d: message %d read at %v, before it was sent at %v", seed, message.ID, *message.ReadAt, message.CreatedAt)
+		}
+	}
+	if last := box.messages[len(box.messages)-1]; !conversation.LastMessageAt.Equal(last.CreatedAt) {
+		t.Errorf("seed %d: last message at %v, want %v", seed, *conversation.LastMessageAt, last.CreatedAt)
+	}
+
+	if len(box.participants) != len(members) {
+		t.Errorf("seed %d: %d participants, want %d", seed, len(box.participants), len(members))
+	}
+	for _, participant := range box.participants {
+		if participant.LastReadMessageID == nil {
+			continue
+		}
+		message := messages[*participant.LastReadMessageID]
+		if message == nil {
+			t.Errorf("seed %d: %s read message %d of another conversation", seed, participant.UserID, *participant.LastReadMessageID)
+			continue
+		}
+		if participant.LastReadAt.Before(message.CreatedAt) || participant.LastReadAt.After(now) {
+			t.Errorf("seed %d: %s read message %d at %v, outside %v to %v", seed, participant.UserID, message.ID, *participant.LastReadAt, message.CreatedAt, now)
+		}
+	}
+
+	for _, reaction := range box.reactions {
+		message := messages[reaction.MessageID]
+		if message == nil || !isMember[reaction.UserID] || reaction.UserID == message.SenderID {
+			t.Errorf("seed %d: %s reacted to message %d", seed, reaction.UserID, reaction.MessageID)
+			continue
+		}
+		if reaction.CreatedAt.Before(message.CreatedAt) {
+			t.Errorf("seed %d: %s reacted to message %d at %v, before it was sent", seed, reaction.UserID, message.ID, reaction.CreatedAt)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log"
+	"sort"
+
+	"data-loader/migrations"
+)
+
+// runMigrate applies every embedded migration in file name order. The files
+// are idempotent, so running the command again is harmless.
+func runMigrate(args []string) error {
+	flags := newFlagSet("migrate", "migrate")
+	flags.Parse(args)
+
+	if err := openDatabase(); err != nil {
+		return err
+	}
+
+	names, err := fs.Glob(migrations.Files, "*.sql")
+	if err != nil {
+		return err
+	}
+	sort.Strings(names)
+
+	ctx := context.Background()
+	for _, name := range names {
+		script, err := migrations.Files.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		if _, err := rawDB.ExecContext(ctx, string(script)); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		log.Printf("applied %s", name)
+	}
+	return nil
+}
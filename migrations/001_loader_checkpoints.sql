@@ -0,0 +1,28 @@
+-- bookkeeping of the data-loader, used by `load --resume`
+create table if not exists loader_runs
+(
+    id             bigint generated by default as identity
+        constraint loader_runs_pk
+            primary key,
+    seed           bigint                                not null,
+    reference_time timestamptz,
+    stages         text                                  not null,
+    status         varchar     default 'running'         not null,
+    started_at     timestamptz default current_timestamp not null,
+    finished_at    timestamptz
+);
+
+create table if not exists loader_checkpoints
+(
+    run_id         bigint                                not null
+        constraint loader_checkpoints_loader_runs_id_fk
+            references loader_runs,
+    stage          varchar                               not null,
+    step           integer     default 0                 not null,
+    batch_table    varchar,
+    committed_rows bigint      default 0                 not null,
+    completed_at   timestamptz,
+    updated_at     timestamptz default current_timestamp not null,
+    constraint loader_checkpoints_pk
+        primary key (run_id, stage)
+);
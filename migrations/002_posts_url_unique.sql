@@ -0,0 +1,11 @@
+-- posts are identified by their url when the loader runs with --on-conflict=skip|update
+do
+$$
+    begin
+        alter table posts
+            add constraint posts_url_uk
+                unique (url);
+    exception
+        when duplicate_table or duplicate_object then null;
+    end
+$$;
@@ -0,0 +1,3 @@
+-- the highest id of every table a run assigns ids for, so that `load --resume` assigns the same ids again
+alter table loader_runs
+    add column if not exists id_bases jsonb;
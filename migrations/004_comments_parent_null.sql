@@ -0,0 +1,15 @@
+-- top-level comments have a NULL parent_comment_id instead of 0, replies reference their parent
+update comments
+set parent_comment_id = null
+where parent_comment_id = 0;
+
+do
+$$
+    begin
+        alter table comments
+            add constraint comments_comments_id_fk
+                foreign key (parent_comment_id) references comments;
+    exception
+        when duplicate_object then null;
+    end
+$$;
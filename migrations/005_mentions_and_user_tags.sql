@@ -0,0 +1,54 @@
+-- @mentions in captions and comments and users tagged in post images
+create table if not exists post_mentions
+(
+    post_id           bigint
+        constraint post_mentions_posts_id_fk
+            references posts,
+    mentioned_user_id uuid
+        constraint post_mentions_users_id_fk
+            references users,
+    created_at        timestamptz default current_timestamp not null,
+    constraint post_mentions_pk
+        primary key (post_id, mentioned_user_id)
+);
+
+create table if not exists comment_mentions
+(
+    comment_id        bigint
+        constraint comment_mentions_comments_id_fk
+            references comments,
+    mentioned_user_id uuid
+        constraint comment_mentions_users_id_fk
+            references users,
+    created_at        timestamptz default current_timestamp not null,
+    constraint comment_mentions_pk
+        primary key (comment_id, mentioned_user_id)
+);
+
+create table if not exists post_image_user_tags
+(
+    post_image_id bigint
+        constraint post_image_user_tags_post_images_id_fk
+            references post_images,
+    user_id       uuid
+        constraint post_image_user_tags_users_id_fk
+            references users,
+    x             double precision                      not null
+        constraint post_image_user_tags_x_check
+            check (x between 0 and 1),
+    y             double precision                      not null
+        constraint post_image_user_tags_y_check
+            check (y between 0 and 1),
+    created_at    timestamptz default current_timestamp not null,
+    constraint post_image_user_tags_pk
+        primary key (post_image_id, user_id)
+);
+
+-- post_mentions
+CREATE INDEX IF NOT EXISTS idx_post_mentions_mentioned_user_id ON post_mentions (mentioned_user_id);
+
+-- comment_mentions
+CREATE INDEX IF NOT EXISTS idx_comment_mentions_mentioned_user_id ON comment_mentions (mentioned_user_id);
+
+-- post_image_user_tags
+CREATE INDEX IF NOT EXISTS idx_post_image_user_tags_user_id ON post_image_user_tags (user_id);
@@ -0,0 +1,82 @@
+-- direct messages: conversations, their participants, messages and reactions
+create table if not exists conversations
+(
+    id              bigint generated by default as identity
+        constraint conversations_pk
+            primary key,
+    is_group        bool        default false             not null,
+    title           varchar,
+    created_by      uuid                                  not null
+        constraint conversations_users_id_fk
+            references users,
+    last_message_at timestamptz,
+    created_at      timestamptz default current_timestamp not null,
+    updated_at      timestamptz,
+    deleted_at      timestamptz
+);
+
+create table if not exists messages
+(
+    id              bigint generated by default as identity
+        constraint messages_pk
+            primary key,
+    conversation_id bigint                                not null
+        constraint messages_conversations_id_fk
+            references conversations,
+    sender_id       uuid                                  not null
+        constraint messages_users_id_fk
+            references users,
+    text            text,
+    shared_post_id  bigint
+        constraint messages_posts_id_fk
+            references posts,
+    read_at         timestamptz,
+    created_at      timestamptz default current_timestamp not null,
+    deleted_at      timestamptz
+);
+
+create table if not exists conversation_participants
+(
+    conversation_id      bigint                                not null
+        constraint conversation_participants_conversations_id_fk
+            references conversations,
+    user_id              uuid                                  not null
+        constraint conversation_participants_users_id_fk
+            references users,
+    joined_at            timestamptz default current_timestamp not null,
+    last_read_message_id bigint
+        constraint conversation_participants_messages_id_fk
+            references messages,
+    last_read_at         timestamptz,
+    constraint conversation_participants_pk
+        primary key (conversation_id, user_id)
+);
+
+create table if not exists message_reactions
+(
+    message_id bigint                                not null
+        constraint message_reactions_messages_id_fk
+            references messages,
+    user_id    uuid                                  not null
+        constraint message_reactions_users_id_fk
+            references users,
+    reaction   varchar                               not null,
+    created_at timestamptz default current_timestamp not null,
+    constraint message_reactions_pk
+        primary key (message_id, user_id)
+);
+
+-- conversations
+CREATE INDEX IF NOT EXISTS idx_conversations_created_by ON conversations (created_by);
+CREATE INDEX IF NOT EXISTS idx_conversations_last_message_at ON conversations (last_message_at);
+
+-- messages
+CREATE INDEX IF NOT EXISTS idx_messages_conversation_id_created_at ON messages (conversation_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_messages_sender_id ON messages (sender_id);
+CREATE INDEX IF NOT EXISTS idx_messages_shared_post_id ON messages (shared_post_id);
+
+-- conversation_participants
+CREATE INDEX IF NOT EXISTS idx_conversation_participants_user_id ON conversation_participants (user_id);
+
+-- message_reactions
+CREATE INDEX IF NOT EXISTS idx_message_reactions_user_id ON message_reactions (user_id);
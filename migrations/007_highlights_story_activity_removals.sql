@@ -0,0 +1,7 @@
+-- a highlight story can be added and removed again, one row per event
+alter table highlights_story_activity
+    drop constraint if exists highlights_story_activity_pk;
+
+alter table highlights_story_activity
+    add constraint highlights_story_activity_pk
+        primary key (story_id, highlight_id, is_removed);
@@ -0,0 +1,10 @@
+// Package migrations holds the schema changes made after the initial ddl.sql.
+// A fresh database created by docker compose already contains them, older
+// databases are brought up to date with `data-loader migrate`. Every file can
+// be applied more than once.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var Files embed.FS
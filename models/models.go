@@ -55,6 +55,10 @@ type FollowersActivity struct {
 	Following   User      `gorm:"foreignKey:FollowingID"`
 }
 
+func (f *FollowersActivity) TableName() string {
+	return "followers_activity"
+}
+
 type Location struct {
 	ID            int64  `gorm:"primaryKey,autoIncrement"`
 	HasPublicPage bool   `gorm:"default:false"`
@@ -139,12 +143,16 @@ type HighlightsStory struct {
 type HighlightsStoryActivity struct {
 	HighlightID int64     `gorm:"primaryKey"`
 	StoryID     string    `gorm:"primaryKey"`
-	IsRemoved   bool      `gorm:"default:false"`
+	IsRemoved   bool      `gorm:"primaryKey;default:false"`
 	CreatedAt   time.Time `gorm:"autoCreateTime"`
 	Highlight   Highlight `gorm:"foreignKey:HighlightID"`
 	Story       Story     `gorm:"foreignKey:StoryID"`
 }
 
+func (h *HighlightsStoryActivity) TableName() string {
+	return "highlights_story_activity"
+}
+
 type HashTag struct {
 	ID        int64      `gorm:"primaryKey"`
 	Name      string     `gorm:"not null"`
@@ -172,6 +180,34 @@ type StoryTag struct {
 	Tag       HashTag   `gorm:"foreignKey:TagID"`
 }
 
+type PostMention struct {
+	PostID          int64     `gorm:"primaryKey"`
+	MentionedUserID string    `gorm:"primaryKey"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	Post            Post      `gorm:"foreignKey:PostID"`
+	MentionedUser   User      `gorm:"foreignKey:MentionedUserID"`
+}
+
+type CommentMention struct {
+	CommentID       int64     `gorm:"primaryKey"`
+	MentionedUserID string    `gorm:"primaryKey"`
+	CreatedAt       time.Time `gorm:"autoCreateTime"`
+	Comment         Comment   `gorm:"foreignKey:CommentID"`
+	MentionedUser   User      `gorm:"foreignKey:MentionedUserID"`
+}
+
+// PostImageUserTag is a user tagged in a post image, X and Y are the position
+// of the tag as a fraction of the image width and height.
+type PostImageUserTag struct {
+	PostImageID int64     `gorm:"primaryKey"`
+	UserID      string    `gorm:"primaryKey"`
+	X           float64   `gorm:"not null"`
+	Y           float64   `gorm:"not null"`
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	PostImage   PostImage `gorm:"foreignKey:PostImageID"`
+	User        User      `gorm:"foreignKey:UserID"`
+}
+
 type Block struct {
 	UserID    string    `gorm:"primaryKey"`
 	BlockedID string    `gorm:"primaryKey"`
@@ -180,15 +216,23 @@ type Block struct {
 	Blocked   User      `gorm:"foreignKey:BlockedID"`
 }
 
+func (b *Block) TableName() string {
+	return "block"
+}
+
 type BlockActivity struct {
 	UserID    string     `gorm:"primaryKey"`
 	BlockedID string     `gorm:"primaryKey"`
 	CreatedAt time.Time  `gorm:"autoCreateTime"`
 	UpdatedAt *time.Time `gorm:"autoUpdateTime"`
 	DeletedAt *time.Time `gorm:"index"`
-	IsBlock   bool       `gorm:"default:true"`
-	User      User       `gorm:"foreignKey:UserID"`
-	Blocked   User       `gorm:"foreignKey:BlockedID"`
+	IsBlock   bool
+	User      User `gorm:"foreignKey:UserID"`
+	Blocked   User `gorm:"foreignKey:BlockedID"`
+}
+
+func (b *BlockActivity) TableName() string {
+	return "block_activity"
 }
 
 type Restrict struct {
@@ -201,20 +245,28 @@ type Restrict struct {
 	RestrictUser   User       `gorm:"foreignKey:RestrictUserID"`
 }
 
+func (r *Restrict) TableName() string {
+	return "restrict"
+}
+
 type RestrictActivity struct {
-	UserID         string    `gorm:"primaryKey"`
-	RestrictUserID string    `gorm:"primaryKey"`
-	IsRestrict     bool      `gorm:"default:true"`
+	UserID         string `gorm:"primaryKey"`
+	RestrictUserID string `gorm:"primaryKey"`
+	IsRestrict     bool
 	CreatedAt      time.Time `gorm:"autoCreateTime"`
 	User           User      `gorm:"foreignKey:UserID"`
 	RestrictUser   User      `gorm:"foreignKey:RestrictUserID"`
 }
 
+func (r *RestrictActivity) TableName() string {
+	return "restrict_activity"
+}
+
 type Comment struct {
-	ID              int64  `gorm:"primaryKey" json:"-"`
-	PostID          int64  `gorm:"index" json:"-"`
-	UserID          string `gorm:"index" json:"-"`
-	ParentCommentID int64
+	ID              int64      `gorm:"primaryKey" json:"-"`
+	PostID          int64      `gorm:"index" json:"-"`
+	UserID          string     `gorm:"index" json:"-"`
+	ParentCommentID *int64     `json:"-"`
 	CommentText     string     `gorm:"not null" json:"comment_text"`
 	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"created_at"`
 	UpdatedAt       *time.Time `gorm:"autoUpdateTime" json:"updated_at"`
@@ -232,14 +284,18 @@ type CommentLike struct {
 }
 
 type CommentActivity struct {
-	CommentID int64     `gorm:"primaryKey"`
-	ActionBy  string    `gorm:"primaryKey"`
-	IsLike    bool      `gorm:"default:true"`
+	CommentID int64  `gorm:"primaryKey"`
+	ActionBy  string `gorm:"primaryKey"`
+	IsLike    bool
 	CreatedAt time.Time `gorm:"autoCreateTime"`
 	Comment   Comment   `gorm:"foreignKey:CommentID"`
 	User      User      `gorm:"foreignKey:ActionBy"`
 }
 
+func (c *CommentActivity) TableName() string {
+	return "comment_activity"
+}
+
 type PostLikes struct {
 	PostID  int64     `gorm:"primaryKey"`
 	UserID  string    `gorm:"primaryKey"`
@@ -247,3 +303,75 @@ type PostLikes struct {
 	Post    Post      `gorm:"foreignKey:PostID"`
 	User    User      `gorm:"foreignKey:UserID"`
 }
+
+// Conversation is a direct message thread, between two users or a group.
+type Conversation struct {
+	ID            int64 `gorm:"primaryKey"`
+	IsGroup       bool  `gorm:"default:false"`
+	Title         *string
+	CreatedBy     string `gorm:"index"`
+	LastMessageAt *time.Time
+	CreatedAt     time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt     *time.Time `gorm:"autoUpdateTime"`
+	DeletedAt     *time.Time `gorm:"index"`
+	Creator       User       `gorm:"foreignKey:CreatedBy"`
+}
+
+// ConversationParticipant is a member of a conversation, LastReadMessageID
+// the last message they have read.
+type ConversationParticipant struct {
+	ConversationID    int64     `gorm:"primaryKey"`
+	UserID            string    `gorm:"primaryKey"`
+	JoinedAt          time.Time `gorm:"autoCreateTime"`
+	LastReadMessageID *int64
+	LastReadAt        *time.Time
+	Conversation      Conversation `gorm:"foreignKey:ConversationID"`
+	User              User         `gorm:"foreignKey:UserID"`
+}
+
+// Message is a text or a shared post sent to a conversation, Text is nil for a
+// shared post. ReadAt is when the last of the other participants read it.
+type Message struct {
+	ID             int64  `gorm:"primaryKey"`
+	ConversationID int64  `gorm:"index"`
+	SenderID       string `gorm:"index"`
+	Text           *string
+	SharedPostID   *int64 `gorm:"index"`
+	ReadAt         *time.Time
+	CreatedAt      time.Time    `gorm:"autoCreateTime"`
+	DeletedAt      *time.Time   `gorm:"index"`
+	Conversation   Conversation `gorm:"foreignKey:ConversationID"`
+	Sender         User         `gorm:"foreignKey:SenderID"`
+	SharedPost     *Post        `gorm:"foreignKey:SharedPostID"`
+}
+
+type MessageReaction struct {
+	MessageID int64     `gorm:"primaryKey"`
+	UserID    string    `gorm:"primaryKey"`
+	Reaction  string    `gorm:"not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	Message   Message   `gorm:"foreignKey:MessageID"`
+	User      User      `gorm:"foreignKey:UserID"`
+}
+
+type LoaderRun struct {
+	ID            int64 `gorm:"primaryKey"`
+	Seed          int64
+	ReferenceTime *time.Time
+	Stages        string
+	Status        string `gorm:"default:running"`
+	StartedAt     time.Time
+	FinishedAt    *time.Time
+	IDBases       map[string]int64 `gorm:"serializer:json"`
+}
+
+type LoaderCheckpoint struct {
+	RunID         int64  `gorm:"primaryKey"`
+	Stage         string `gorm:"primaryKey"`
+	Step          int    `gorm:"default:0"`
+	BatchTable    string
+	CommittedRows int64 `gorm:"default:0"`
+	CompletedAt   *time.Time
+	UpdatedAt     time.Time
+	Run           LoaderRun `gorm:"foreignKey:RunID"`
+}
@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	outputPostgres = "postgres"
+	outputCSV      = "csv"
+	outputSQL      = "sql"
+	outputParquet  = "parquet"
+)
+
+var (
+	outputFormat = flag.String("output", outputPostgres, "where load writes the tables: postgres, or csv, sql or parquet files in --output-dir without a database")
+	outputDir    = flag.String("output-dir", "output", "directory of the files written with --output csv, sql or parquet")
+)
+
+// fileOutput is the sink of every batch writer when the run writes files.
+var fileOutput *fileSink
+
+// tableFormat writes batches of rows to files, one table after the other or
+// interleaved. close gets the tables in the order they were first written,
+// which respects the foreign keys, and the identities to advance.
+type tableFormat interface {
+	writeRows(table string, fields []*schema.Field, values [][]interface{}) error
+	close(tables []string, identities []identity) error
+}
+
+// identity is the last id assigned to the identity column of a table.
+type identity struct {
+	table  string
+	column string
+	last   int64
+}
+
+// fileSink writes the batches to files instead of the database. The rows are
+// spooled so that later stages can read them back through loadTable, and
+// written to the files when the run is complete and the counters are known.
+type fileSink struct {
+	mu      sync.Mutex
+	format  tableFormat
+	store   *rowStore
+	tables  []string
+	written map[string]bool
+}
+
+func openOutput(format, dir string) (*fileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	store, err := newRowStore()
+	if err != nil {
+		return nil, err
+	}
+	s := &fileSink{store: store, written: map[string]bool{}}
+	switch format {
+	case outputCSV:
+		s.format = &csvFormat{dir: dir, files: map[string]*tableFile{}, columns: map[string][]string{}}
+	case outputSQL:
+		file, err := createTableFile(filepath.Join(dir, "data.sql"))
+		if err != nil {
+			return nil, err
+		}
+		s.format = &sqlFormat{file: file}
+		if _, err := file.WriteString("BEGIN;\n"); err != nil {
+			return nil, err
+		}
+	case outputParquet:
+		s.format = &parquetFormat{dir: dir, tables: map[string]*parquetTable{}}
+	default:
+		return nil, fmt.Errorf("invalid --output %q, expected postgres, csv, sql or parquet", format)
+	}
+	return s, nil
+}
+
+// write has no transaction to checkpoint in, a run writing files cannot be
+// resumed.
+func (s *fileSink) write(ctx context.Context, table string, rows interface{}, _ func(execFunc) error) error {
+	slice := reflect.ValueOf(rows)
+	if slice.Kind() != reflect.Slice {
+		return fmt.Errorf("expected a slice of rows, got %T", rows)
+	}
+	if slice.Len() == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := completeRows(ctx, slice); err != nil {
+		return err
+	}
+	fields, values, err := rowValues(ctx, rows, false)
+	if err != nil {
+		return err
+	}
+	if err := s.store.add(table, fields, values); err != nil {
+		return err
+	}
+
+	if !s.written[table] {
+		s.written[table] = true
+		s.tables = append(s.tables, table)
+	}
+	return nil
+}
+
+// completeRows sets what the database would fill in on insert: create and
+// update times and column defaults. The ids come from the idAllocator.
+func completeRows(ctx context.Context, slice reflect.Value) error {
+	model, err := modelSchema(slice.Index(0).Interface())
+	if err != nil {
+		return err
+	}
+
+	now := clock()
+	for i := 0; i < slice.Len(); i++ {
+		row := reflect.Indirect(slice.Index(i))
+		for _, field := range model.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if _, zero := field.ValueOf(ctx, row); !zero {
+				continue
+			}
+			var err error
+			switch {
+			case field.AutoCreateTime > 0 || field.AutoUpdateTime > 0:
+				err = field.Set(ctx, row, now)
+			case field.DefaultValueInterface != nil:
+				err = field.Set(ctx, row, field.DefaultValueInterface)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fileBatchSize is the number of rows written to the files at a time, the rows
+// of one INSERT of the sql format.
+const fileBatchSize = 1000
+
+// recounted are the counters the followers and post-likes stages set from the
+// rows they write. A run writing files sets them when it writes the parent
+// table, if the child table is part of the run.
+var recounted = []counter{
+	{"users", "following_count", "followers", "follower_id"},
+	{"users", "followers_count", "followers", "following_id"},
+	{"posts", "likes_count", "post_likes", "post_id"},
+}
+
+// close writes the spooled tables to the files, the tables can be loaded once
+// it returned.
+func (s *fileSink) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer s.store.close()
+
+	for _, table := range s.tables {
+		if err := s.writeTable(table); err != nil {
+			return fmt.Errorf("writing %s: %w", table, err)
+		}
+	}
+	return s.format.close(s.tables, ids.identities())
+}
+
+// writeTable streams the spooled rows of table to the files, with the
+// recounted counters.
+func (s *fileSink) writeTable(table string) error {
+	counts := map[string]map[interface{}]int64{}
+	for _, c := range recounted {
+		if c.table != table || !s.written[c.child] {
+			continue
+		}
+		byID := map[interface{}]int64{}
+		err := s.store.each(c.child, func(fields []*schema.Field, values []interface{}) error {
+			column := columnIndex(fields, c.column)
+			if column < 0 {
+				return fmt.Errorf("%s has no column %s", c.child, c.column)
+			}
+			byID[values[column]]++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		counts[c.field] = byID
+	}
+
+	var fields []*schema.Field
+	batch := [][]interface{}{}
+	err := s.store.each(table, func(f []*schema.Field, values []interface{}) error {
+		fields = f
+		for field, byID := range counts {
+			column, id := columnIndex(fields, field), columnIndex(fields, "id")
+			if column < 0 || id < 0 {
+				return fmt.Errorf("%s has no column %s or id", table, field)
+			}
+			values[column] = byID[values[id]]
+		}
+		batch = append(batch, values)
+		if len(batch) < fileBatchSize {
+			return nil
+		}
+		err := s.format.writeRows(table, fields, batch)
+		batch = [][]interface{}{}
+		return err
+	})
+	if err != nil || len(batch) == 0 {
+		return err
+	}
+	return s.format.writeRows(table, fields, batch)
+}
+
+// columnIndex is the index of column in fields, -1 when it is not one of them.
+func columnIndex(fields []*schema.Field, column string) int {
+	for i, field := range fields {
+		if field.DBName == column {
+			return i
+		}
+	}
+	return -1
+}
+
+// tableFile is a buffered output file.
+type tableFile struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func createTableFile(path string) (*tableFile, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &tableFile{Writer: bufio.NewWriterSize(file, 1<<20), file: file}, nil
+}
+
+func (f *tableFile) Close() error {
+	if err := f.Flush(); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// plainValue dereferences a column value, a nil pointer is NULL.
+func plainValue(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil
+	}
+	return v.Interface()
+}
+
+const timestampLayout = "2006-01-02 15:04:05.999999-07:00"
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// setvalStatement advances the sequence of an identity column past the ids
+// assigned client-side, tables without one are left alone.
+func setvalStatement(ident identity) string {
+	return fmt.Sprintf("SELECT setval(seq, %d) FROM pg_get_serial_sequence('%s', '%s') AS seq WHERE seq IS NOT NULL;\n", ident.last, quoteIdentifier(ident.table), ident.column)
+}
+
+// csvFormat writes <table>.csv for every table, with a header, and load.psql
+// loading them with \copy. Strings are always quoted and NULL is an unquoted
+// empty field, which is how COPY tells an empty string from NULL.
+type csvFormat struct {
+	dir     string
+	files   map[string]*tableFile
+	columns map[string][]string
+}
+
+func (f *csvFormat) writeRows(table string, fields []*schema.Field, values [][]interface{}) error {
+	file, ok := f.files[table]
+	if !ok {
+		var err error
+		file, err = createTableFile(filepath.Join(f.dir, table+".csv"))
+		if err != nil {
+			return err
+		}
+		f.files[table] = file
+		f.columns[table] = columnNames(fields)
+		file.WriteString(strings.Join(f.columns[table], ",") + "\n")
+	}
+
+	for _, row := range values {
+		for j, value := range row {
+			if j > 0 {
+				file.WriteByte(',')
+			}
+			file.WriteString(csvField(value))
+		}
+		if err := file.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func csvField(value interface{}) string {
+	switch v := plainValue(value).(type) {
+	case nil:
+		return ""
+	case string:
+		return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+	case time.Time:
+		return v.Format(timestampLayout)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (f *csvFormat) close(tables []string, identities []identity) error {
+	for _, table := range tables {
+		if err := f.files[table].Close(); err != nil {
+			return err
+		}
+	}
+
+	script, err := createTableFile(filepath.Join(f.dir, "load.psql"))
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		fmt.Fprintf(script, "\\copy %s (%s) FROM '%s.csv' WITH (FORMAT csv, HEADER true)\n", quoteIdentifier(table), quoteIdentifiers(f.columns[table]), table)
+	}
+	for _, ident := range identities {
+		script.WriteString(setvalStatement(ident))
+	}
+	return script.Close()
+}
+
+// sqlFormat writes data.sql, one multi-row INSERT per batch in a single
+// transaction.
+type sqlFormat struct {
+	file *tableFile
+}
+
+func (f *sqlFormat) writeRows(table string, fields []*schema.Field, values [][]interface{}) error {
+	fmt.Fprintf(f.file, "INSERT INTO %s (%s) VALUES\n", quoteIdentifier(table), quoteIdentifiers(columnNames(fields)))
+	for i, row := range values {
+		literals := make([]string, len(row))
+		for j, value := range row {
+			literals[j] = sqlLiteral(value)
+		}
+		end := ",\n"
+		if i == len(values)-1 {
+			end = ";\n"
+		}
+		if _, err := f.file.WriteString("(" + strings.Join(literals, ", ") + ")" + end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqlLiteral(value interface{}) string {
+	switch v := plainValue(value).(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case time.Time:
+		return "'" + v.Format(timestampLayout) + "'"
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func (f *sqlFormat) close(_ []string, identities []identity) error {
+	for _, ident := range identities {
+		f.file.WriteString(setvalStatement(ident))
+	}
+	f.file.WriteString("COMMIT;\n")
+	return f.file.Close()
+}
+
+// parquetFormat writes <table>.parquet for every table, every column is
+// optional and typed after the model field.
+type parquetFormat struct {
+	dir    string
+	tables map[string]*parquetTable
+}
+
+type parquetTable struct {
+	file    *tableFile
+	writer  *parquet.Writer
+	columns []parquet.LeafColumn
+}
+
+func (f *parquetFormat) writeRows(table string, fields []*schema.Field, values [][]interface{}) error {
+	t, ok := f.tables[table]
+	if !ok {
+		var err error
+		t, err = f.create(table, fields)
+		if err != nil {
+			return err
+		}
+		f.tables[table] = t
+	}
+
+	rows := make([]parquet.Row, len(values))
+	for i, row := range values {
+		rows[i] = make(parquet.Row, len(row))
+		for j, value := range row {
+			column := t.columns[j]
+			v := parquetValue(plainValue(value))
+			if v.IsNull() {
+				rows[i][column.ColumnIndex] = v.Level(0, 0, column.ColumnIndex)
+			} else {
+				rows[i][column.ColumnIndex] = v.Level(0, column.MaxDefinitionLevel, column.ColumnIndex)
+			}
+		}
+	}
+	_, err := t.writer.WriteRows(rows)
+	return err
+}
+
+func (f *parquetFormat) create(table string, fields []*schema.Field) (*parquetTable, error) {
+	group := parquet.Group{}
+	for _, field := range fields {
+		node, err := parquetNode(field)
+		if err != nil {
+			return nil, err
+		}
+		group[field.DBName] = parquet.Optional(node)
+	}
+	s := parquet.NewSchema(table, group)
+
+	t := &parquetTable{}
+	for _, field := range fields {
+		column, _ := s.Lookup(field.DBName)
+		t.columns = append(t.columns, column)
+	}
+
+	var err error
+	t.file, err = createTableFile(filepath.Join(f.dir, table+".parquet"))
+	if err != nil {
+		return nil, err
+	}
+	t.writer = parquet.NewWriter(t.file, s)
+	return t, nil
+}
+
+func parquetNode(field *schema.Field) (parquet.Node, error) {
+	typ := field.FieldType
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == reflect.TypeOf(time.Time{}) {
+		return parquet.Timestamp(parquet.Microsecond), nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return parquet.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return parquet.Int(64), nil
+	case reflect.Float32, reflect.Float64:
+		return parquet.Leaf(parquet.DoubleType), nil
+	case reflect.Bool:
+		return parquet.Leaf(parquet.BooleanType), nil
+	}
+	return nil, fmt.Errorf("column %s has type %s without a parquet mapping", field.DBName, field.FieldType)
+}
+
+func parquetValue(value interface{}) parquet.Value {
+	switch v := value.(type) {
+	case nil:
+		return parquet.NullValue()
+	case string:
+		return parquet.ByteArrayValue([]byte(v))
+	case time.Time:
+		return parquet.Int64Value(v.UnixMicro())
+	case bool:
+		return parquet.BooleanValue(v)
+	case float64:
+		return parquet.DoubleValue(v)
+	case float32:
+		return parquet.DoubleValue(float64(v))
+	}
+	return parquet.Int64Value(reflect.ValueOf(value).Int())
+}
+
+func (f *parquetFormat) close(tables []string, _ []identity) error {
+	for _, table := range tables {
+		t := f.tables[table]
+		if err := t.writer.Close(); err != nil {
+			return err
+		}
+		if err := t.file.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestFieldEscaping(t *testing.T) {
+	text := `it's "quoted"`
+	var missing *string
+	at := time.Date(2024, time.January, 2, 3, 4, 5, 500000000, time.UTC)
+
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantCSV string
+		wantSQL string
+	}{
+		{name: "nil", value: nil, wantCSV: "", wantSQL: "NULL"},
+		{name: "nil pointer", value: missing, wantCSV: "", wantSQL: "NULL"},
+		{name: "empty string", value: "", wantCSV: `""`, wantSQL: "''"},
+		{name: "plain string", value: "hello", wantCSV: `"hello"`, wantSQL: "'hello'"},
+		{name: "quotes", value: text, wantCSV: `"it's ""quoted"""`, wantSQL: `'it''s "quoted"'`},
+		{name: "string pointer", value: &text, wantCSV: `"it's ""quoted"""`, wantSQL: `'it''s "quoted"'`},
+		{name: "comma and newline", value: "a,b\nc", wantCSV: "\"a,b\nc\"", wantSQL: "'a,b\nc'"},
+		{name: "backslash", value: `C:\path`, wantCSV: `"C:\path"`, wantSQL: `'C:\path'`},
+		{name: "time", value: at, wantCSV: "2024-01-02 03:04:05.5+00:00", wantSQL: "'2024-01-02 03:04:05.5+00:00'"},
+		{name: "time pointer", value: &at, wantCSV: "2024-01-02 03:04:05.5+00:00", wantSQL: "'2024-01-02 03:04:05.5+00:00'"},
+		{name: "bool", value: true, wantCSV: "true", wantSQL: "TRUE"},
+		{name: "int", value: int64(-42), wantCSV: "-42", wantSQL: "-42"},
+		{name: "float", value: 0.25, wantCSV: "0.25", wantSQL: "0.25"},
+		{name: "large float", value: 1e21, wantCSV: "1e+21", wantSQL: "1e+21"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := csvField(tt.value); got != tt.wantCSV {
+				t.Errorf("csvField(%#v) = %q, want %q", tt.value, got, tt.wantCSV)
+			}
+			if got := sqlLiteral(tt.value); got != tt.wantSQL {
+				t.Errorf("sqlLiteral(%#v) = %q, want %q", tt.value, got, tt.wantSQL)
+			}
+		})
+	}
+}
+
+func TestFileSinkSpoolsRowsAndRecountsCounters(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	setClock(&now)
+	dir := t.TempDir()
+	sink, err := openOutput(outputCSV, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids = newIDAllocator(nil)
+	fileOutput = sink
+	t.Cleanup(func() {
+		fileOutput = nil
+		setClock(nil)
+	})
+
+	ctx := context.Background()
+	users := []*models.User{
+		{ID: "a", Username: "alice", FollowersCount: 1000, FollowingCount: 7},
+		{ID: "b", Username: "bob", FollowersCount: 5},
+		{ID: "c", Username: "carol", FollowingCount: 3},
+	}
+	follows := []*models.Follower{
+		{FollowerID: "b", FollowingID: "a"},
+		{FollowerID: "c", FollowingID: "a"},
+		{FollowerID: "a", FollowingID: "b"},
+	}
+	text := "hi"
+	shared := int64(3)
+	messages := []*models.Message{
+		{ID: 2, ConversationID: 1, SenderID: "a", SharedPostID: &shared},
+		{ID: 1, ConversationID: 1, SenderID: "b", Text: &text},
+	}
+	for _, err := range []error{
+		sink.write(ctx, "users", users, nil),
+		sink.write(ctx, "followers", follows, nil),
+		sink.write(ctx, "messages", messages, nil),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read, err := loadTable[*models.Message](ctx, "messages", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 2 || read[0].ID != 1 || read[1].ID != 2 {
+		t.Fatalf("read %+v, want the messages ordered by id", read)
+	}
+	if read[0].Text == nil || *read[0].Text != "hi" || read[0].SharedPostID != nil {
+		t.Errorf("text message read back as %+v", read[0])
+	}
+	if read[1].Text != nil || read[1].SharedPostID == nil || *read[1].SharedPostID != 3 {
+		t.Errorf("shared post message read back as %+v", read[1])
+	}
+	if !read[0].CreatedAt.Equal(now) {
+		t.Errorf("created_at read back as %s, want %s", read[0].CreatedAt, now)
+	}
+
+	if err := sink.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(sink.store.dir); !os.IsNotExist(err) {
+		t.Errorf("spool directory %s was not removed", sink.store.dir)
+	}
+	written, err := os.ReadFile(filepath.Join(dir, "users.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// id, username, following_count, followers_count
+	want := []string{`"a","alice",1,2,`, `"b","bob",1,1,`, `"c","carol",1,0,`}
+	lines := strings.Split(string(written), "\n")
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i+1], prefix) {
+			t.Errorf("users.csv line %d is %q, want it to start with %q", i+2, lines[i+1], prefix)
+		}
+	}
+}
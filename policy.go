@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	onErrorStop     = "stop"
+	onErrorRetry    = "retry"
+	onErrorContinue = "continue"
+)
+
+// errorPolicy decides what the runner does when a stage fails.
+//
+//	stop:     cancel the run, no further stage is started
+//	retry:    retry statements failing with a transient database error, then stop
+//	continue: skip the stages depending on the failed one and run the others
+type errorPolicy struct {
+	Mode       string
+	Retries    int
+	RetryDelay time.Duration
+}
+
+func (p errorPolicy) validate() error {
+	switch p.Mode {
+	case onErrorStop, onErrorRetry, onErrorContinue:
+	default:
+		return fmt.Errorf("invalid --on-error %q, expected stop, retry or continue", p.Mode)
+	}
+	if p.Retries < 0 {
+		return fmt.Errorf("--retries must not be negative")
+	}
+	return nil
+}
+
+type policyKey struct{}
+
+func withPolicy(ctx context.Context, policy errorPolicy) context.Context {
+	return context.WithValue(ctx, policyKey{}, policy)
+}
+
+// withRetries runs fn and, when the run uses the retry policy, runs it again
+// with a growing delay for as long as it fails with a transient error.
+func withRetries(ctx context.Context, fn func() error) error {
+	policy, _ := ctx.Value(policyKey{}).(errorPolicy)
+
+	err := fn()
+	for attempt := 1; err != nil && policy.Mode == onErrorRetry && attempt <= policy.Retries && isTransient(err); attempt++ {
+		log.Printf("retrying in %s (attempt %d of %d): %v", policy.RetryDelay*time.Duration(attempt), attempt, policy.Retries, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(policy.RetryDelay * time.Duration(attempt)):
+		}
+		err = fn()
+	}
+	return err
+}
+
+// isTransient reports whether err is a connection problem or a postgres error
+// that is expected to go away when the statement is sent again.
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) || pgconn.SafeToRetry(err) {
+		return true
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && len(pgErr.Code) >= 2 {
+		switch pgErr.Code[:2] {
+		// connection exception, transaction rollback (serialization failure,
+		// deadlock), insufficient resources, operator intervention
+		case "08", "40", "53", "57":
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/url"
+)
+
+var scaleFactor = flag.Float64("scale", 1, "size of the loaded data relative to the dataset: profiles are cloned with perturbed counts, e.g. 10 for ten times the users, posts and everything derived from them")
+
+// cloneSpread is the standard deviation of the log of the factor a clone's
+// counts are multiplied with.
+const cloneSpread = 0.25
+
+// cloneShift is how far the posts of a clone are moved in time, either way.
+const cloneShift = 90 * 24 * 60 * 60
+
+// forEachScaledProfile streams the valid profiles of the dataset in path
+// --scale times over: every profile is followed by its clones, and with a
+// fractional scale some profiles get one clone more than others. A clone has
+// a unique username and post URLs, perturbed counts and dates, media URLs
+// recycled from the profile it was cloned from, so it shares its locations and
+// highlights, and a generated bio and captions carrying the profile's
+// hashtags. Clones are derived from the run seed and the profile, every pass
+// over the dataset yields the same clones.
+func forEachScaledProfile(path string, fn func(Data) error) error {
+	if *scaleFactor <= 0 {
+		return fmt.Errorf("invalid --scale %v, expected a positive factor", *scaleFactor)
+	}
+	if err := validateText(); err != nil {
+		return err
+	}
+	texts, accounts, err := datasetCorpus(path)
+	if err != nil {
+		return err
+	}
+	taken := make(map[string]bool, len(accounts))
+	for _, account := range accounts {
+		taken[account] = true
+	}
+
+	index := 0
+	return forEachValidProfile(path, func(data Data) error {
+		copies := int(math.Floor(*scaleFactor*float64(index+1)) - math.Floor(*scaleFactor*float64(index)))
+		index++
+		for k := 0; k < copies; k++ {
+			profile := data
+			if k > 0 {
+				profile = cloneProfile(data, k, taken, texts, accounts)
+			}
+			if err := fn(profile); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// cloneProfile makes clone k of data. taken are the accounts clones must not
+// take, accounts the dataset accounts its texts mention.
+func cloneProfile(data Data, k int, taken map[string]bool, texts *textCorpus, accounts []string) Data {
+	rng := stageRand(runSeed, fmt.Sprintf("clone %s %d", data.Account, k))
+
+	clone := data
+	clone.Account = fmt.Sprintf("%s_%d", data.Account, k)
+	for n := 2; taken[clone.Account]; n++ {
+		clone.Account = fmt.Sprintf("%s_%d_%d", data.Account, k, n)
+	}
+	taken[clone.Account] = true
+	if data.Id != "" {
+		clone.Id = fmt.Sprintf("%s_%d", data.Id, k)
+	}
+	clone.Fbid = ""
+	clone.Biography = texts.generate(rng, bioText, data.CountryCode, accounts, data.PostHashtags)
+
+	clone.Followers = perturb(rng, data.Followers)
+	clone.Following = perturb(rng, data.Following)
+	clone.PostsCount = max(perturb(rng, data.PostsCount), int64(len(data.Posts)))
+	clone.HighlightsCount = perturb(rng, data.HighlightsCount)
+
+	clone.Posts = make([]DataPost, len(data.Posts))
+	for i, post := range data.Posts {
+		recycled := data.Posts[rng.Intn(len(data.Posts))]
+		post.Caption = texts.generate(rng, captionText, data.CountryCode, accounts, data.PostHashtags)
+		post.ImageUrl = recycled.ImageUrl
+		post.VideoUrl = recycled.VideoUrl
+		post.Likes = perturb(rng, post.Likes)
+		post.Comments = perturb(rng, post.Comments)
+		post.VideoViewCount = perturb(rng, post.VideoViewCount)
+		post.Url = cloneURL(post.Url, k)
+		if post.Id != "" {
+			post.Id = fmt.Sprintf("%s_%d", post.Id, k)
+		}
+		if post.Datetime != 0 {
+			shifted := int64(post.Datetime) + rng.Int63n(2*cloneShift+1) - cloneShift
+			post.Datetime = int(min(max(shifted, instagramLaunch.Unix()), clock().Unix()))
+		}
+		clone.Posts[i] = post
+	}
+
+	clone.Highlights = make([]DataHighlight, len(data.Highlights))
+	for i, highlight := range data.Highlights {
+		highlight.Image = data.Highlights[rng.Intn(len(data.Highlights))].Image
+		highlight.Owner = clone.Account
+		clone.Highlights[i] = highlight
+	}
+	return clone
+}
+
+// perturb multiplies a count with a random factor around 1.
+func perturb(rng *rand.Rand, count int64) int64 {
+	if count <= 0 {
+		return count
+	}
+	return int64(math.Round(float64(count) * math.Exp(rng.NormFloat64()*cloneSpread)))
+}
+
+// cloneURL makes the URL of a cloned post unique, it stays a valid URL.
+func cloneURL(raw string, k int) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Sprintf("%s#clone-%d", raw, k)
+	}
+	query := u.Query()
+	query.Set("clone", fmt.Sprint(k))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runOptions configure a single load run.
+type runOptions struct {
+	Parallel int
+	Policy   errorPolicy
+	Seed     int64
+	Run      *loadRun
+}
+
+type stageResult struct {
+	stage   *stage
+	err     error
+	elapsed time.Duration
+}
+
+// validateStages makes sure every stage requires known stages and that the
+// requirements do not form a cycle.
+func validateStages(all []*stage) error {
+	byName := map[string]*stage{}
+	for _, s := range all {
+		if _, ok := byName[s.Name]; ok {
+			return fmt.Errorf("stage %s is registered twice", s.Name)
+		}
+		byName[s.Name] = s
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+	var visit func(s *stage, path []string) error
+	visit = func(s *stage, path []string) error {
+		switch state[s.Name] {
+		case visiting:
+			return fmt.Errorf("stage dependency cycle: %s", strings.Join(append(path, s.Name), " -> "))
+		case visited:
+			return nil
+		}
+		state[s.Name] = visiting
+		for _, name := range s.Requires {
+			dep, ok := byName[name]
+			if !ok {
+				return fmt.Errorf("stage %s requires unknown stage %s", s.Name, name)
+			}
+			if err := visit(dep, append(path, s.Name)); err != nil {
+				return err
+			}
+		}
+		state[s.Name] = visited
+		return nil
+	}
+
+	for _, s := range all {
+		if err := visit(s, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// schedule runs the selected stages as soon as the stages they require within
+// the selection have finished, with at most parallel stages at a time. Unless
+// the policy is to continue, the first failure cancels ctx and no further stage
+// is started. With continue only the stages depending on a failed stage are
+// held back. Stages that never ran are reported as skipped.
+func schedule(ctx context.Context, selected []*stage, opts runOptions) error {
+	parallel := max(opts.Parallel, 1)
+	policy := opts.Policy
+
+	ctx, cancel := context.WithCancel(withPolicy(ctx, policy))
+	defer cancel()
+
+	inRun := map[string]bool{}
+	for _, s := range selected {
+		inRun[s.Name] = true
+	}
+
+	pending := map[string]int{}
+	dependents := map[string][]*stage{}
+	for _, s := range selected {
+		for _, name := range s.Requires {
+			if inRun[name] {
+				pending[s.Name]++
+				dependents[name] = append(dependents[name], s)
+			}
+		}
+	}
+
+	ready := []*stage{}
+	for _, s := range selected {
+		if pending[s.Name] == 0 {
+			ready = append(ready, s)
+		}
+	}
+
+	results := make(chan stageResult)
+	running := 0
+	finished := map[string]bool{}
+	failed := []stageResult{}
+
+	for {
+		for (len(failed) == 0 || policy.Mode == onErrorContinue) && ctx.Err() == nil && len(ready) > 0 && running < parallel {
+			s := ready[0]
+			ready = ready[1:]
+			running++
+			go func(s *stage) {
+				start := time.Now()
+				stageCtx := ctx
+				var progress *stageProgress
+				if opts.Run != nil {
+					progress = opts.Run.progress(s.Name)
+					if progress.completed {
+						log.Printf("stage %s: completed in run %d, skipping", s.Name, opts.Run.ID)
+						results <- stageResult{stage: s}
+						return
+					}
+					stageCtx = withProgress(ctx, progress)
+				}
+
+				log.Printf("stage %s: started", s.Name)
+				err := s.Run(stageCtx, stageRand(opts.Seed, s.Name))
+				if err == nil && progress != nil {
+					err = progress.complete(ctx)
+				}
+				if err != nil {
+					err = fmt.Errorf("stage %s: %w", s.Name, err)
+				}
+				results <- stageResult{stage: s, err: err, elapsed: time.Since(start)}
+			}(s)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		result := <-results
+		running--
+		finished[result.stage.Name] = true
+
+		if result.err != nil {
+			log.Printf("%v (failed after %s)", result.err, result.elapsed.Round(time.Millisecond))
+			failed = append(failed, result)
+			if policy.Mode != onErrorContinue {
+				cancel()
+			}
+			continue
+		}
+
+		log.Printf("stage %s: done in %s", result.stage.Name, result.elapsed.Round(time.Millisecond))
+		for _, dependent := range dependents[result.stage.Name] {
+			pending[dependent.Name]--
+			if pending[dependent.Name] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+
+	skipped := []string{}
+	for _, s := range selected {
+		if !finished[s.Name] {
+			skipped = append(skipped, s.Name)
+		}
+	}
+
+	if len(failed) == 0 {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("load interrupted, skipped stages: %s", strings.Join(skipped, ", "))
+		}
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].stage.Name < failed[j].stage.Name })
+	report := []string{}
+	for _, result := range failed {
+		report = append(report, result.err.Error())
+	}
+	if len(skipped) > 0 {
+		report = append(report, fmt.Sprintf("skipped stages: %s", strings.Join(skipped, ", ")))
+	}
+	return fmt.Errorf("load failed\n  %s", strings.Join(report, "\n  "))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestScheduleReportsFailedAndSkippedStages(t *testing.T) {
+	boom := errors.New("boom")
+	transient := fmt.Errorf("insert: %w", driver.ErrBadConn)
+
+	tests := []struct {
+		name string
+		mode string
+		// failures are the errors of the successive attempts of stage b
+		failures    []error
+		wantErr     []string
+		wantRan     []string
+		wantSkipped string
+	}{
+		{
+			name:        "stop",
+			mode:        onErrorStop,
+			failures:    []error{boom},
+			wantErr:     []string{"stage b: boom"},
+			wantRan:     []string{"a", "b"},
+			wantSkipped: "skipped stages: c, d",
+		},
+		{
+			name:        "stop does not retry",
+			mode:        onErrorStop,
+			failures:    []error{transient},
+			wantErr:     []string{"stage b: insert: driver: bad connection"},
+			wantRan:     []string{"a", "b"},
+			wantSkipped: "skipped stages: c, d",
+		},
+		{
+			name:     "retry recovers",
+			mode:     onErrorRetry,
+			failures: []error{transient, transient},
+			wantRan:  []string{"a", "b", "c", "d"},
+		},
+		{
+			name:        "retry gives up on a permanent error",
+			mode:        onErrorRetry,
+			failures:    []error{transient, boom},
+			wantErr:     []string{"stage b: boom"},
+			wantRan:     []string{"a", "b"},
+			wantSkipped: "skipped stages: c, d",
+		},
+		{
+			name:        "retry gives up after the retries",
+			mode:        onErrorRetry,
+			failures:    []error{transient, transient, transient, transient},
+			wantErr:     []string{"stage b: insert: driver: bad connection"},
+			wantRan:     []string{"a", "b"},
+			wantSkipped: "skipped stages: c, d",
+		},
+		{
+			name:        "continue",
+			mode:        onErrorContinue,
+			failures:    []error{boom},
+			wantErr:     []string{"stage b: boom"},
+			wantRan:     []string{"a", "b", "d"},
+			wantSkipped: "skipped stages: c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			ran := []string{}
+			run := func(name string, failures []error) func(context.Context, *rand.Rand) error {
+				return func(ctx context.Context, _ *rand.Rand) error {
+					mu.Lock()
+					ran = append(ran, name)
+					mu.Unlock()
+					attempt := 0
+					return withRetries(ctx, func() error {
+						attempt++
+						if attempt <= len(failures) {
+							return failures[attempt-1]
+						}
+						return nil
+					})
+				}
+			}
+			// d only requires a, but is ready after b, so stop never starts it
+			selected := []*stage{
+				{Name: "a", Run: run("a", nil)},
+				{Name: "b", Requires: []string{"a"}, Run: run("b", tt.failures)},
+				{Name: "c", Requires: []string{"b"}, Run: run("c", nil)},
+				{Name: "d", Requires: []string{"a"}, Run: run("d", nil)},
+			}
+
+			err := schedule(context.Background(), selected, runOptions{
+				Parallel: 1,
+				Policy:   errorPolicy{Mode: tt.mode, Retries: 3},
+			})
+
+			sort.Strings(ran)
+			if strings.Join(ran, ",") != strings.Join(tt.wantRan, ",") {
+				t.Errorf("ran %v, want %v", ran, tt.wantRan)
+			}
+			if len(tt.wantErr) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			for _, want := range append(tt.wantErr, tt.wantSkipped) {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// seededNow is the reference time of seeded runs that do not pass --now.
+var seededNow = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	seedFlag = flag.Int64("seed", 0, "seed of the random generators, two runs with the same inputs and seed produce the same data (default random)")
+	nowFlag  = flag.String("now", "", "RFC 3339 reference time for generated timestamps (default the current time, 2024-01-01T00:00:00Z with --seed)")
+)
+
+// resolveSeed returns the --seed value, or a time based seed when the flag is
+// not given. The second result tells whether the seed was given explicitly.
+func resolveSeed() (int64, bool) {
+	explicit := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			explicit = true
+		}
+	})
+	if explicit {
+		return *seedFlag, true
+	}
+	return time.Now().UnixNano(), false
+}
+
+// runSeed is the seed of the current load, for what every stage has to draw
+// alike, such as the clones of a scaled run.
+var runSeed int64
+
+// clock fills the created_at and similar columns, see setClock.
+var clock = time.Now
+
+// resolveNow returns the reference time of the run, nil means the wall clock.
+// A seeded run uses a fixed clock so that its tables are byte-identical.
+func resolveNow(seeded bool) (*time.Time, error) {
+	if *nowFlag != "" {
+		now, err := time.Parse(time.RFC3339, *nowFlag)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --now: %w", err)
+		}
+		return &now, nil
+	}
+	if seeded {
+		now := seededNow
+		return &now, nil
+	}
+	return nil, nil
+}
+
+func setClock(reference *time.Time) {
+	if reference == nil {
+		clock = time.Now
+		return
+	}
+	now := *reference
+	clock = func() time.Time { return now }
+}
+
+// stageRand derives the generator of a stage from the run seed and the stage
+// name, so a stage draws the same numbers whichever stages run next to it.
+func stageRand(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+// newUUID draws a version 4 uuid from rng instead of crypto/rand.
+func newUUID(rng *rand.Rand) string {
+	return uuid.Must(uuid.NewRandomFromReader(rng)).String()
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/stdlib"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var useCopy = flag.Bool("copy", true, "load followers, comments, comment_likes, post_likes, stories and post_images with COPY FROM STDIN instead of INSERT")
+
+const (
+	// copyBatchSize is the number of rows of one COPY, a batch is still the
+	// unit of retries and checkpoints.
+	copyBatchSize = 50000
+	// maxBindParams is the limit of parameters of a single INSERT.
+	maxBindParams = 65535
+)
+
+// execFunc runs a statement within the transaction of a batch.
+type execFunc func(query string, args ...interface{}) error
+
+// sink stores the batches of a batchWriter. write stores rows, a slice of a
+// model, and calls checkpoint within the same transaction.
+type sink interface {
+	write(ctx context.Context, table string, rows interface{}, checkpoint func(execFunc) error) error
+}
+
+// insertSink writes a batch with one INSERT through gorm.
+type insertSink struct {
+	clauses []clause.Expression
+}
+
+func (s insertSink) write(ctx context.Context, table string, rows interface{}, checkpoint func(execFunc) error) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(s.clauses...).Create(rows).Error; err != nil {
+			return err
+		}
+		return checkpoint(func(query string, args ...interface{}) error {
+			return tx.Exec(query, args...).Error
+		})
+	})
+}
+
+// copySink writes a batch with COPY FROM STDIN on a pgx connection taken
+// from the pool. The columns and values come from the gorm schema of the
+// model, with the defaults gorm would fill in on create.
+type copySink struct{}
+
+func (copySink) write(ctx context.Context, table string, rows interface{}, checkpoint func(execFunc) error) error {
+	fields, values, err := rowValues(ctx, rows, true)
+	if err != nil {
+		return err
+	}
+	columns := columnNames(fields)
+
+	conn, err := rawDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		pgxConn := driverConn.(*stdlib.Conn).Conn()
+		uuidColumns, err := lookupUUIDColumns(ctx, pgxConn, table)
+		if err != nil {
+			return err
+		}
+		if err := encodeUUIDs(columns, values, uuidColumns); err != nil {
+			return err
+		}
+
+		return pgx.BeginFunc(ctx, pgxConn, func(tx pgx.Tx) error {
+			if _, err := tx.CopyFrom(ctx, pgx.Identifier{table}, columns, pgx.CopyFromRows(values)); err != nil {
+				return err
+			}
+			return checkpoint(func(query string, args ...interface{}) error {
+				_, err := tx.Exec(ctx, query, args...)
+				return err
+			})
+		})
+	})
+}
+
+var uuidColumnCache sync.Map
+
+// lookupUUIDColumns returns the uuid columns of table. COPY uses the binary
+// format, which has no encoding from a Go string to uuid.
+func lookupUUIDColumns(ctx context.Context, conn *pgx.Conn, table string) (map[string]bool, error) {
+	if cached, ok := uuidColumnCache.Load(table); ok {
+		return cached.(map[string]bool), nil
+	}
+	rows, err := conn.Query(ctx, "SELECT column_name FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND udt_name = 'uuid'", table)
+	if err != nil {
+		return nil, err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	columns := map[string]bool{}
+	for _, name := range names {
+		columns[name] = true
+	}
+	uuidColumnCache.Store(table, columns)
+	return columns, nil
+}
+
+func encodeUUIDs(columns []string, values [][]interface{}, uuidColumns map[string]bool) error {
+	for j, column := range columns {
+		if !uuidColumns[column] {
+			continue
+		}
+		for _, row := range values {
+			var text string
+			switch value := row[j].(type) {
+			case string:
+				text = value
+			case *string:
+				if value == nil {
+					row[j] = pgtype.UUID{}
+					continue
+				}
+				text = *value
+			default:
+				continue
+			}
+			id, err := uuid.Parse(text)
+			if err != nil {
+				return fmt.Errorf("column %s: %w", column, err)
+			}
+			row[j] = pgtype.UUID{Bytes: id, Valid: true}
+		}
+	}
+	return nil
+}
+
+var schemaCache sync.Map
+
+// namingStrategy is the gorm default, models are parsed without a connection
+// when the run writes files.
+var namingStrategy = schema.NamingStrategy{IdentifierMaxLength: 64}
+
+func modelSchema(model interface{}) (*schema.Schema, error) {
+	return schema.Parse(model, &schemaCache, namingStrategy)
+}
+
+// rowValues returns the fields of the rows and their values. With
+// omitDefaults, columns left to a database default, such as identity ids, are
+// omitted when no row sets them. Zero create and update times are set to the
+// clock and other zero values to their gorm default, like gorm does on create.
+func rowValues(ctx context.Context, rows interface{}, omitDefaults bool) ([]*schema.Field, [][]interface{}, error) {
+	slice := reflect.ValueOf(rows)
+	if slice.Kind() != reflect.Slice {
+		return nil, nil, fmt.Errorf("expected a slice of rows, got %T", rows)
+	}
+	if slice.Len() == 0 {
+		return nil, nil, nil
+	}
+	s, err := modelSchema(slice.Index(0).Interface())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := clock()
+	fields := []*schema.Field{}
+	for _, name := range s.DBNames {
+		field := s.FieldsByDBName[name]
+		if omitDefaults && field.HasDefaultValue && field.DefaultValueInterface == nil && allZero(ctx, field, slice) {
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	values := make([][]interface{}, slice.Len())
+	for i := range values {
+		row := reflect.Indirect(slice.Index(i))
+		values[i] = make([]interface{}, len(fields))
+		for j, field := range fields {
+			value, zero := field.ValueOf(ctx, row)
+			switch {
+			case zero && (field.AutoCreateTime > 0 || field.AutoUpdateTime > 0):
+				value = now
+			case zero && field.DefaultValueInterface != nil:
+				value = field.DefaultValueInterface
+			}
+			values[i][j] = value
+		}
+	}
+	return fields, values, nil
+}
+
+func columnNames(fields []*schema.Field) []string {
+	columns := make([]string, len(fields))
+	for i, field := range fields {
+		columns[i] = field.DBName
+	}
+	return columns
+}
+
+func allZero(ctx context.Context, field *schema.Field, slice reflect.Value) bool {
+	for i := 0; i < slice.Len(); i++ {
+		if _, zero := field.ValueOf(ctx, reflect.Indirect(slice.Index(i))); !zero {
+			return false
+		}
+	}
+	return true
+}
+
+// bulkSink is the sink of the large generated tables and its batch size.
+func bulkSink(model interface{}) (sink, int, error) {
+	if *useCopy {
+		return copySink{}, copyBatchSize, nil
+	}
+	size, err := insertBatchSize(model)
+	if err != nil {
+		return nil, 0, err
+	}
+	return insertSink{}, size, nil
+}
+
+// insertBatchSize is the number of rows of model that fit in one INSERT.
+func insertBatchSize(model interface{}) (int, error) {
+	s, err := modelSchema(model)
+	if err != nil {
+		return 0, err
+	}
+	return maxBindParams / len(s.DBNames), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+
+	"data-loader/models"
+)
+
+func TestRowValues(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	setClock(&now)
+	t.Cleanup(func() { setClock(nil) })
+	posted := now.AddDate(0, -1, 0)
+	id := int64(7)
+
+	tests := []struct {
+		name         string
+		rows         []*models.Post
+		omitDefaults bool
+		wantID       bool
+	}{
+		{name: "identity left to the database", rows: []*models.Post{{Caption: "a"}, {Caption: "b"}}, omitDefaults: true},
+		{name: "identity set by a row", rows: []*models.Post{{Caption: "a"}, {ID: &id, Caption: "b"}}, omitDefaults: true, wantID: true},
+		{name: "every column", rows: []*models.Post{{Caption: "a"}, {Caption: "b"}}, wantID: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rows[0].CreatedAt = posted
+			fields, values, err := rowValues(context.Background(), tt.rows, tt.omitDefaults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			column := map[string]int{}
+			for i, name := range columnNames(fields) {
+				column[name] = i
+			}
+			if _, ok := column["id"]; ok != tt.wantID {
+				t.Errorf("id column included %v, want %v", ok, tt.wantID)
+			}
+			if len(values) != len(tt.rows) {
+				t.Fatalf("%d rows of values, want %d", len(values), len(tt.rows))
+			}
+			for i, want := range []string{"a", "b"} {
+				if got := values[i][column["caption"]]; got != want {
+					t.Errorf("row %d caption %v, want %s", i, got, want)
+				}
+			}
+			if got := values[0][column["created_at"]]; got != posted {
+				t.Errorf("set created_at became %v, want %v", got, posted)
+			}
+			if got := values[1][column["created_at"]]; got != now {
+				t.Errorf("zero created_at became %v, want the clock %v", got, now)
+			}
+		})
+	}
+}
+
+func TestEncodeUUIDs(t *testing.T) {
+	const id = "0b7e1a52-8c5b-4d8e-9a39-5a0c4f1f3c11"
+	text := id
+	var missing *string
+
+	columns := []string{"id", "user_id", "name"}
+	values := [][]interface{}{
+		{id, &text, id},
+		{id, missing, "plain"},
+	}
+	if err := encodeUUIDs(columns, values, map[string]bool{"id": true, "user_id": true}); err != nil {
+		t.Fatal(err)
+	}
+	for i, row := range values {
+		if got, ok := row[0].(pgtype.UUID); !ok || !got.Valid {
+			t.Errorf("row %d id %#v, want a valid uuid", i, row[0])
+		}
+	}
+	if got, ok := values[0][1].(pgtype.UUID); !ok || !got.Valid {
+		t.Errorf("string pointer %#v, want a valid uuid", values[0][1])
+	}
+	if got, ok := values[1][1].(pgtype.UUID); !ok || got.Valid {
+		t.Errorf("nil pointer %#v, want a NULL uuid", values[1][1])
+	}
+	if _, ok := values[0][2].(string); !ok {
+		t.Errorf("column outside the uuid columns encoded as %#v", values[0][2])
+	}
+
+	err := encodeUUIDs([]string{"id"}, [][]interface{}{{"not-a-uuid"}}, map[string]bool{"id": true})
+	if err == nil {
+		t.Error("encoded an invalid uuid without an error")
+	}
+}
+
+func TestBulkSink(t *testing.T) {
+	copyFlag := *useCopy
+	t.Cleanup(func() { *useCopy = copyFlag })
+
+	*useCopy = true
+	s, size, err := bulkSink(&models.Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(copySink); !ok || size != copyBatchSize {
+		t.Errorf("with --copy got %T with batches of %d, want copySink with %d", s, size, copyBatchSize)
+	}
+
+	*useCopy = false
+	s, size, err = bulkSink(&models.Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := insertBatchSize(&models.Comment{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.(insertSink); !ok || size != want {
+		t.Errorf("with --copy=false got %T with batches of %d, want insertSink with %d", s, size, want)
+	}
+}
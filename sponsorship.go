@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+
+	"data-loader/models"
+)
+
+var (
+	sponsoredFraction = flag.Float64("sponsored-fraction", 0.05, "fraction of posts marked as sponsored by a random business account")
+	sponsorshipsFile  = flag.String("sponsorships", "", "optional JSON or JSON Lines file of {\"post_url\", \"sponsor\"} records naming the sponsor of a post by username")
+)
+
+// sponsorshipRecord is one explicit mapping of the --sponsorships file.
+type sponsorshipRecord struct {
+	PostURL string `json:"post_url"`
+	Sponsor string `json:"sponsor"`
+}
+
+// sponsorships decides which posts are sponsored and by whom. A post listed in
+// the mapping file gets the sponsor named there; any other post is sponsored
+// with probability fraction, by a business account other than its author.
+// Posts at the scraped "Sponsered" location are always sponsored.
+type sponsorships struct {
+	rng      *rand.Rand
+	fraction float64
+	sponsors []string
+	byURL    map[string]string
+}
+
+func loadSponsorships(ctx context.Context, rng *rand.Rand) (*sponsorships, error) {
+	if err := validateRates(map[string]float64{"sponsored-fraction": *sponsoredFraction}); err != nil {
+		return nil, err
+	}
+	s := &sponsorships{rng: rng, fraction: *sponsoredFraction, byURL: map[string]string{}}
+
+	businesses, err := loadTable[models.Business](ctx, "businesses", "user_id")
+	if err != nil {
+		return nil, err
+	}
+	for i, business := range businesses {
+		if i == 0 || business.UserID != businesses[i-1].UserID {
+			s.sponsors = append(s.sponsors, business.UserID)
+		}
+	}
+	if len(s.sponsors) == 0 && s.fraction > 0 {
+		log.Println("there are no business accounts to sponsor posts, only mapped posts are sponsored")
+	}
+
+	if *sponsorshipsFile == "" {
+		return s, nil
+	}
+	userIDs, err := lookupUserIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = forEachRecord(*sponsorshipsFile, func(record sponsorshipRecord) error {
+		sponsorID, ok := userIDs[record.Sponsor]
+		if !ok {
+			return fmt.Errorf("%s: sponsor %q of %s is not a loaded user", *sponsorshipsFile, record.Sponsor, record.PostURL)
+		}
+		s.byURL[record.PostURL] = sponsorID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// apply sets is_sponsored and sponsor_id of post. location is the location
+// name of the post in the dataset, empty when it has none.
+func (s *sponsorships) apply(post *models.Post, location string) {
+	// draw for every post so that the mapping file does not shift the others
+	draw := s.rng.Float64()
+
+	if sponsorID, ok := s.byURL[post.URL]; ok {
+		post.IsSponsored = true
+		post.SponsorID = &sponsorID
+		return
+	}
+	if draw >= s.fraction && location != "Sponsered" {
+		return
+	}
+	post.IsSponsored = true
+	if sponsorID := s.pick(post.UserID); sponsorID != "" {
+		post.SponsorID = &sponsorID
+	}
+}
+
+// pick returns a business account other than author, empty if there is none.
+func (s *sponsorships) pick(author string) string {
+	if len(s.sponsors) == 0 || len(s.sponsors) == 1 && s.sponsors[0] == author {
+		return ""
+	}
+	for {
+		sponsorID := s.sponsors[s.rng.Intn(len(s.sponsors))]
+		if sponsorID != author {
+			return sponsorID
+		}
+	}
+}
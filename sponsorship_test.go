@@ -0,0 +1,84 @@
+package main
+
+import (
+	"testing"
+
+	"data-loader/models"
+)
+
+func TestSponsorshipsApply(t *testing.T) {
+	tests := []struct {
+		name          string
+		fraction      float64
+		sponsors      []string
+		url           string
+		location      string
+		wantSponsored bool
+		// wantSponsor is the expected sponsor, "any" for a sponsor other than
+		// the author and "" for none
+		wantSponsor string
+	}{
+		{name: "not sponsored", fraction: 0, sponsors: []string{"shop", "cafe"}, url: "p1"},
+		{name: "mapped post", fraction: 0, sponsors: []string{"shop"}, url: "mapped", wantSponsored: true, wantSponsor: "brand"},
+		{name: "sponsored location", fraction: 0, sponsors: []string{"shop", "cafe"}, url: "p1", location: "Sponsered", wantSponsored: true, wantSponsor: "any"},
+		{name: "drawn sponsor", fraction: 1, sponsors: []string{"shop", "author", "cafe"}, url: "p1", wantSponsored: true, wantSponsor: "any"},
+		{name: "author is the only business", fraction: 1, sponsors: []string{"author"}, url: "p1", wantSponsored: true},
+		{name: "no businesses", fraction: 1, url: "p1", wantSponsored: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(1); seed <= 10; seed++ {
+				s := &sponsorships{
+					rng:      stageRand(seed, "posts"),
+					fraction: tt.fraction,
+					sponsors: tt.sponsors,
+					byURL:    map[string]string{"mapped": "brand"},
+				}
+				post := &models.Post{UserID: "author", URL: tt.url}
+				s.apply(post, tt.location)
+
+				if post.IsSponsored != tt.wantSponsored {
+					t.Fatalf("seed %d: sponsored %v, want %v", seed, post.IsSponsored, tt.wantSponsored)
+				}
+				sponsor := ""
+				if post.SponsorID != nil {
+					sponsor = *post.SponsorID
+				}
+				switch tt.wantSponsor {
+				case "any":
+					if sponsor == "" || sponsor == post.UserID {
+						t.Errorf("seed %d: sponsor %q, want a business other than the author", seed, sponsor)
+					}
+				default:
+					if sponsor != tt.wantSponsor {
+						t.Errorf("seed %d: sponsor %q, want %q", seed, sponsor, tt.wantSponsor)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSponsorshipsMappingKeepsDraws(t *testing.T) {
+	posts := []string{"p1", "p2", "mapped", "p3", "p4", "p5", "p6", "p7"}
+	sponsored := func(byURL map[string]string) []bool {
+		s := &sponsorships{rng: stageRand(1, "posts"), fraction: 0.5, sponsors: []string{"shop"}, byURL: byURL}
+		result := []bool{}
+		for _, url := range posts {
+			post := &models.Post{UserID: "author", URL: url}
+			s.apply(post, "")
+			if url != "mapped" {
+				result = append(result, post.IsSponsored)
+			}
+		}
+		return result
+	}
+
+	without, with := sponsored(map[string]string{}), sponsored(map[string]string{"mapped": "brand"})
+	for i := range without {
+		if without[i] != with[i] {
+			t.Fatalf("the mapping changed whether other posts are sponsored: %v, want %v", with, without)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+)
+
+// stage is a single step of the loader. Requires lists the stages whose
+// tables must already be populated before this stage can run, the scheduler
+// also uses it to order the stages of a run.
+type stage struct {
+	Name        string
+	Description string
+	Requires    []string
+	Tables      []string
+	// ReadsDataset marks the stages reading the profile dataset, which is
+	// validated once before any of them runs.
+	ReadsDataset bool
+	Run          func(ctx context.Context, rng *rand.Rand) error
+}
+
+var stages = []*stage{
+	{
+		Name:         "users",
+		Description:  "users from the profile dataset",
+		Tables:       []string{"users"},
+		ReadsDataset: true,
+		Run:          createUser,
+	},
+	{
+		Name:         "businesses",
+		Description:  "business addresses of business accounts",
+		Requires:     []string{"users"},
+		Tables:       []string{"businesses"},
+		ReadsDataset: true,
+		Run:          createBusiness,
+	},
+	{
+		Name:         "locations",
+		Description:  "distinct post locations",
+		Tables:       []string{"locations"},
+		ReadsDataset: true,
+		Run:          createLocations,
+	},
+	{
+		Name:         "posts",
+		Description:  "posts from the profile dataset, sponsored by business accounts",
+		Requires:     []string{"users", "businesses", "locations"},
+		Tables:       []string{"posts"},
+		ReadsDataset: true,
+		Run:          createPosts,
+	},
+	{
+		Name:         "hashtags",
+		Description:  "distinct hashtags used by the profiles",
+		Tables:       []string{"hash_tags"},
+		ReadsDataset: true,
+		Run:          createHashTags,
+	},
+	{
+		Name:        "post-tags",
+		Description: "hashtags found in post captions",
+		Requires:    []string{"posts", "hashtags"},
+		Tables:      []string{"post_tags"},
+		Run:         createPostTagsConcurrently,
+	},
+	{
+		Name:         "highlights",
+		Description:  "profile highlights",
+		Requires:     []string{"users"},
+		Tables:       []string{"highlights"},
+		ReadsDataset: true,
+		Run:          createHighlights,
+	},
+	{
+		Name:        "followers",
+		Description: "a follower graph with the heavy-tailed degrees, reciprocity and clustering of the scraped profiles",
+		Requires:    []string{"users"},
+		Tables:      []string{"followers"},
+		Run:         createFollowers,
+	},
+	{
+		Name:        "comments",
+		Description: "threaded comments made by followers of the post author or, without followers, random users, texts generated from comments.json",
+		Requires:    []string{"posts", "followers", "hashtags"},
+		Tables:      []string{"comments"},
+		Run:         createComments,
+	},
+	{
+		Name:        "post-likes",
+		Description: "post likes made by followers of the post author",
+		Requires:    []string{"posts", "followers"},
+		Tables:      []string{"post_likes"},
+		Run:         createPostLikes,
+	},
+	{
+		Name:        "post-images",
+		Description: "post images from post_images.json",
+		Requires:    []string{"posts"},
+		Tables:      []string{"post_images"},
+		Run:         createPostImages,
+	},
+	{
+		Name:        "comment-likes",
+		Description: "comment likes made by followers of the post author",
+		Requires:    []string{"comments", "followers"},
+		Tables:      []string{"comment_likes"},
+		Run:         createCommentLikes,
+	},
+	{
+		Name:        "stories",
+		Description: "stories from stories.json",
+		Requires:    []string{"users"},
+		Tables:      []string{"stories"},
+		Run:         createStories,
+	},
+	{
+		Name:        "story-views",
+		Description: "followers viewing and liking stories within 24 hours",
+		Requires:    []string{"stories", "followers"},
+		Tables:      []string{"story_views"},
+		Run:         createStoryViews,
+	},
+	{
+		Name:        "story-tags",
+		Description: "random hashtags on stories",
+		Requires:    []string{"stories", "hashtags"},
+		Tables:      []string{"story_tags"},
+		Run:         createStoryTags,
+	},
+	{
+		Name:        "highlight-stories",
+		Description: "stories added to highlights",
+		Requires:    []string{"highlights", "stories"},
+		Tables:      []string{"highlights_stories"},
+		Run:         createHighlightStories,
+	},
+	{
+		Name:        "mentions",
+		Description: "@mentions of users in post captions and comments",
+		Requires:    []string{"posts", "comments"},
+		Tables:      []string{"post_mentions", "comment_mentions"},
+		Run:         createMentions,
+	},
+	{
+		Name:        "image-user-tags",
+		Description: "users tagged in post images, mostly followers of the author",
+		Requires:    []string{"post-images", "followers"},
+		Tables:      []string{"post_image_user_tags"},
+		Run:         createPostImageUserTags,
+	},
+	{
+		Name:        "followers-activity",
+		Description: "follow and unfollow history ending in the followers table",
+		Requires:    []string{"followers"},
+		Tables:      []string{"followers_activity"},
+		Run:         createFollowersActivity,
+	},
+	{
+		Name:        "blocks",
+		Description: "blocks between unrelated users with their block and unblock history",
+		Requires:    []string{"followers"},
+		Tables:      []string{"block", "block_activity"},
+		Run:         createBlocks,
+	},
+	{
+		Name:        "restricts",
+		Description: "followers restricted by the user they follow, with their history",
+		Requires:    []string{"followers"},
+		Tables:      []string{"restrict", "restrict_activity"},
+		Run:         createRestricts,
+	},
+	{
+		Name:        "messages",
+		Description: "direct and group conversations, mostly between mutual followers, with read state and reactions",
+		Requires:    []string{"followers", "blocks", "posts"},
+		Tables:      []string{"conversations", "messages", "conversation_participants", "message_reactions"},
+		Run:         createMessages,
+	},
+	{
+		Name:        "comment-activity",
+		Description: "like and unlike history ending in comment_likes",
+		Requires:    []string{"comment-likes"},
+		Tables:      []string{"comment_activity"},
+		Run:         createCommentActivity,
+	},
+	{
+		Name:        "highlight-story-activity",
+		Description: "stories added to and removed from highlights",
+		Requires:    []string{"highlight-stories"},
+		Tables:      []string{"highlights_story_activity"},
+		Run:         createHighlightStoryActivity,
+	},
+}
+
+func findStage(name string) (*stage, bool) {
+	for _, s := range stages {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// selectStages resolves the stage names given on the command line, "all"
+// selects every stage. The result keeps the order of stages.
+func selectStages(names []string) ([]*stage, error) {
+	if err := validateStages(stages); err != nil {
+		return nil, err
+	}
+
+	selected := map[string]bool{}
+	for _, name := range names {
+		if name == "all" {
+			for _, s := range stages {
+				selected[s.Name] = true
+			}
+			continue
+		}
+		if _, ok := findStage(name); !ok {
+			return nil, fmt.Errorf("unknown stage %q, see list-stages", name)
+		}
+		selected[name] = true
+	}
+
+	result := []*stage{}
+	for _, s := range stages {
+		if selected[s.Name] {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+// checkPrerequisites makes sure the tables of every required stage that is
+// not part of this run already contain rows. A stage that completed in an
+// earlier run may have left its tables empty, e.g. blocks with --block-rate=0.
+func checkPrerequisites(s *stage, selected []*stage) error {
+	inRun := map[string]bool{}
+	for _, other := range selected {
+		inRun[other.Name] = true
+	}
+
+	for _, name := range s.Requires {
+		if inRun[name] {
+			continue
+		}
+		required, _ := findStage(name)
+		for _, table := range required.Tables {
+			populated, err := tableHasRows(table)
+			if err != nil {
+				return err
+			}
+			if populated {
+				continue
+			}
+			completed, err := stageCompleted(name)
+			if err != nil {
+				return err
+			}
+			if !completed {
+				return fmt.Errorf("stage %s requires %s but table %s is empty, run `load %s` first", s.Name, name, table, name)
+			}
+			break
+		}
+	}
+	return nil
+}
+
+func tableHasRows(table string) (bool, error) {
+	var exists bool
+	err := rawDB.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", table)).Scan(&exists)
+	return exists, err
+}
+
+// stageCompleted reports whether any run completed stage.
+func stageCompleted(stage string) (bool, error) {
+	var exists bool
+	err := rawDB.QueryRow("SELECT EXISTS (SELECT 1 FROM loader_checkpoints WHERE stage = $1 AND completed_at IS NOT NULL)", stage).Scan(&exists)
+	return exists, err
+}
+
+// checkSelection checks the prerequisites of every selected stage before anything is written.
+func checkSelection(selected []*stage) error {
+	for _, s := range selected {
+		if err := checkPrerequisites(s, selected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
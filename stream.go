@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var inputFormat = flag.String("format", "auto", "format of the input files: json (one array), jsonl (one record per line) or auto to detect it per file; .gz files are decompressed")
+
+const (
+	formatAuto  = "auto"
+	formatJSON  = "json"
+	formatJSONL = "jsonl"
+)
+
+// recordReader decodes the records of an input file one at a time, so a file
+// of any size is read with the memory of a single record. A file is either a
+// top level JSON array or JSON Lines, optionally gzip compressed.
+type recordReader[T any] struct {
+	path      string
+	file      *os.File
+	gz        *gzip.Reader
+	buf       *bufio.Reader
+	lines     bool
+	dec       *json.Decoder
+	started   bool
+	index     int
+	line      int
+	malformed int
+	recycle   bool
+	cycles    int
+}
+
+func openRecords[T any](path string) (*recordReader[T], error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recordReader[T]{path: path, file: file, buf: bufio.NewReaderSize(file, 1<<20)}
+
+	if magic, _ := r.buf.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		r.gz, err = gzip.NewReader(r.buf)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		r.buf = bufio.NewReaderSize(r.gz, 1<<20)
+	}
+
+	format, err := detectFormat(path, r.buf)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	r.lines = format == formatJSONL
+	if !r.lines {
+		r.dec = json.NewDecoder(r.buf)
+	}
+	return r, nil
+}
+
+// detectFormat resolves --format for path: the extension decides first, then
+// the first byte of the content, '[' for an array and '{' for JSON Lines.
+func detectFormat(path string, buf *bufio.Reader) (string, error) {
+	switch *inputFormat {
+	case formatJSON, formatJSONL:
+		return *inputFormat, nil
+	case formatAuto:
+	default:
+		return "", fmt.Errorf("invalid --format %q, expected json, jsonl or auto", *inputFormat)
+	}
+
+	switch filepath.Ext(strings.TrimSuffix(path, ".gz")) {
+	case ".jsonl", ".ndjson":
+		return formatJSONL, nil
+	}
+	for i := 1; ; i++ {
+		head, err := buf.Peek(i)
+		if len(head) < i {
+			if err == io.EOF {
+				return formatJSON, nil
+			}
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		switch c := head[i-1]; c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return formatJSONL, nil
+		default:
+			return formatJSON, nil
+		}
+	}
+}
+
+// Next returns the next record, io.EOF after the last one. Malformed JSON
+// Lines are logged with their line number and skipped.
+func (r *recordReader[T]) Next() (T, error) {
+	if r.lines {
+		return r.nextLine()
+	}
+
+	var record T
+	if !r.started {
+		r.started = true
+		token, err := r.dec.Token()
+		if err != nil {
+			return record, fmt.Errorf("%s: %w", r.path, err)
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return record, fmt.Errorf("%s: expected a JSON array, found %v", r.path, token)
+		}
+	}
+
+	if !r.dec.More() {
+		if _, err := r.dec.Token(); err != nil {
+			return record, fmt.Errorf("%s: %w", r.path, err)
+		}
+		return record, io.EOF
+	}
+
+	if err := r.dec.Decode(&record); err != nil {
+		return record, fmt.Errorf("%s: record %d: %w", r.path, r.index, err)
+	}
+	r.index++
+	return record, nil
+}
+
+func (r *recordReader[T]) nextLine() (T, error) {
+	for {
+		var record T
+		line, err := r.buf.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			if err == io.EOF {
+				return record, io.EOF
+			}
+			return record, fmt.Errorf("%s: %w", r.path, err)
+		}
+		r.line++
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		if err := json.Unmarshal(line, &record); err != nil {
+			if r.cycles == 0 {
+				r.malformed++
+				log.Printf("%s:%d: skipping malformed record: %v", r.path, r.line, err)
+			}
+			continue
+		}
+		r.index++
+		return record, nil
+	}
+}
+
+func (r *recordReader[T]) Close() error {
+	if r.malformed > 0 {
+		log.Printf("%s: skipped %d malformed lines", r.path, r.malformed)
+	}
+	return r.closeFile()
+}
+
+func (r *recordReader[T]) closeFile() error {
+	if r.gz != nil {
+		r.gz.Close()
+	}
+	return r.file.Close()
+}
+
+// rewind starts reading the file again from its first record.
+func (r *recordReader[T]) rewind() error {
+	fresh, err := openRecords[T](r.path)
+	if err != nil {
+		return err
+	}
+	r.closeFile()
+	fresh.malformed, fresh.recycle, fresh.cycles = r.malformed, r.recycle, r.cycles+1
+	*r = *fresh
+	return nil
+}
+
+// forEachRecord calls fn for every record of the input file in path.
+func forEachRecord[T any](path string, fn func(T) error) error {
+	reader, err := openRecords[T](path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+// takeRecords reads the next n records, failing when the file has fewer left
+// unless the reader recycles its records.
+func takeRecords[T any](reader *recordReader[T], n int) ([]T, error) {
+	records := make([]T, 0, n)
+	for len(records) < n {
+		record, err := reader.Next()
+		if errors.Is(err, io.EOF) && reader.recycle && reader.index > 0 {
+			if reader.cycles == 0 {
+				log.Printf("%s: all %d records are used, starting over", reader.path, reader.index)
+			}
+			if err := reader.rewind(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%s has only %d records, more are needed", reader.path, reader.index)
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// openInput opens the generated input file named name, see inputPath. A
+// scaled run recycles its records once they are used up.
+func openInput[T any](name string) (*recordReader[T], error) {
+	reader, err := openRecords[T](inputPath(name))
+	if err != nil {
+		return nil, err
+	}
+	reader.recycle = *scaleFactor != 1
+	return reader, nil
+}
+
+// inputPath finds the input file named name in any of the supported formats,
+// name.json, name.jsonl, name.ndjson or a gzipped variant of them.
+func inputPath(name string) string {
+	for _, ext := range []string{".json", ".jsonl", ".ndjson", ".json.gz", ".jsonl.gz", ".ndjson.gz"} {
+		if _, err := os.Stat(name + ext); err == nil {
+			return name + ext
+		}
+	}
+	return name + ".json"
+}
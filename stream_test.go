@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReader(t *testing.T) {
+	type record struct {
+		Name string `json:"name"`
+	}
+
+	tests := []struct {
+		name          string
+		file          string
+		content       string
+		gzip          bool
+		want          []string
+		wantMalformed int
+		wantErr       bool
+	}{
+		{
+			name:    "json",
+			file:    "records.json",
+			content: `[{"name": "a"}, {"name": "b"}]`,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "empty json",
+			file:    "records.json",
+			content: "[]",
+			want:    []string{},
+		},
+		{
+			name:    "jsonl",
+			file:    "records.jsonl",
+			content: "{\"name\": \"a\"}\n\n{\"name\": \"b\"}\n{\"name\": \"c\"}",
+			want:    []string{"a", "b", "c"},
+		},
+		{
+			name:    "jsonl detected by content",
+			file:    "records.txt",
+			content: "  {\"name\": \"a\"}\n{\"name\": \"b\"}\n",
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "json gz",
+			file:    "records.json.gz",
+			content: `[{"name": "a"}, {"name": "b"}]`,
+			gzip:    true,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "jsonl gz",
+			file:    "records.jsonl.gz",
+			content: "{\"name\": \"a\"}\n{\"name\": \"b\"}\n",
+			gzip:    true,
+			want:    []string{"a", "b"},
+		},
+		{
+			name:    "gz without extension",
+			file:    "records",
+			content: "{\"name\": \"a\"}\n",
+			gzip:    true,
+			want:    []string{"a"},
+		},
+		{
+			name:          "malformed jsonl lines are skipped",
+			file:          "records.jsonl",
+			content:       "{\"name\": \"a\"}\n{\"name\": \n[1, 2]\n{\"name\": \"b\"}\nnot json\n",
+			want:          []string{"a", "b"},
+			wantMalformed: 3,
+		},
+		{
+			name:    "malformed json record",
+			file:    "records.json",
+			content: `[{"name": "a"}, {"name": 1}]`,
+			wantErr: true,
+		},
+		{
+			name:    "json that is not an array",
+			file:    "records.json",
+			content: `"a"`,
+			wantErr: true,
+		},
+		{
+			name:    "json object read as jsonl",
+			file:    "records.json",
+			content: `{"name": "a"}`,
+			want:    []string{"a"},
+		},
+		{
+			name:    "truncated json",
+			file:    "records.json",
+			content: `[{"name": "a"}, {"na`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := []byte(tt.content)
+			if tt.gzip {
+				var buf bytes.Buffer
+				w := gzip.NewWriter(&buf)
+				w.Write(content)
+				w.Close()
+				content = buf.Bytes()
+			}
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := openRecords[record](path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			got := []string{}
+			for {
+				r, err := reader.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					if !tt.wantErr {
+						t.Fatal(err)
+					}
+					return
+				}
+				got = append(got, r.Name)
+			}
+			if tt.wantErr {
+				t.Fatalf("expected an error, read %v", got)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("read %v, want %v", got, tt.want)
+			}
+			if reader.malformed != tt.wantMalformed {
+				t.Errorf("%d malformed lines, want %d", reader.malformed, tt.wantMalformed)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// loadTable reads the rows of table ordered by the comma separated columns of
+// order. When the run writes files there is no database, the rows are the
+// ones written earlier in the same run.
+func loadTable[T any](ctx context.Context, table, order string) ([]T, error) {
+	if fileOutput != nil {
+		rows, err := fileOutput.store.rows(table, order, reflect.TypeOf((*T)(nil)).Elem())
+		if err != nil {
+			return nil, err
+		}
+		return rows.([]T), nil
+	}
+	var rows []T
+	err := db.WithContext(ctx).Table(table).Order(order).Find(&rows).Error
+	return rows, err
+}
+
+// rowStore spools the rows written to the files of a run to a temporary
+// directory, one file per table, so that memory does not grow with the tables.
+// Later stages read them back like from the database, and the formats write
+// them once the run is complete.
+type rowStore struct {
+	mu     sync.Mutex
+	dir    string
+	tables map[string]*spool
+}
+
+// spool holds the column values of the rows of a table, gob encoded.
+type spool struct {
+	file   *os.File
+	buf    *bufio.Writer
+	enc    *gob.Encoder
+	fields []*schema.Field
+}
+
+func init() {
+	gob.Register(time.Time{})
+}
+
+func newRowStore() (*rowStore, error) {
+	dir, err := os.MkdirTemp("", "data-loader-")
+	if err != nil {
+		return nil, err
+	}
+	return &rowStore{dir: dir, tables: map[string]*spool{}}, nil
+}
+
+// add spools the column values of rows, one slice per row. Pointers are
+// stored as the value they point to, nil as NULL.
+func (s *rowStore) add(table string, fields []*schema.Field, values [][]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp, ok := s.tables[table]
+	if !ok {
+		file, err := os.Create(filepath.Join(s.dir, table+".gob"))
+		if err != nil {
+			return err
+		}
+		buf := bufio.NewWriterSize(file, 1<<20)
+		sp = &spool{file: file, buf: buf, enc: gob.NewEncoder(buf), fields: fields}
+		s.tables[table] = sp
+	}
+	for _, row := range values {
+		plain := make([]interface{}, len(row))
+		for i, value := range row {
+			plain[i] = plainValue(value)
+		}
+		if err := sp.enc.Encode(plain); err != nil {
+			return fmt.Errorf("spooling %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// each calls fn with the column values of every spooled row of table, in the
+// order they were written.
+func (s *rowStore) each(table string, fn func(fields []*schema.Field, values []interface{}) error) error {
+	s.mu.Lock()
+	sp, ok := s.tables[table]
+	var err error
+	if ok {
+		err = sp.buf.Flush()
+	}
+	s.mu.Unlock()
+	if !ok || err != nil {
+		return err
+	}
+
+	file, err := os.Open(sp.file.Name())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	dec := gob.NewDecoder(bufio.NewReaderSize(file, 1<<20))
+	for {
+		var values []interface{}
+		if err := dec.Decode(&values); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("reading the spooled %s: %w", table, err)
+		}
+		if err := fn(sp.fields, values); err != nil {
+			return err
+		}
+	}
+}
+
+// rows reads the spooled rows of table back as a []model sorted by order,
+// model is the type of the rows or a pointer to it.
+func (s *rowStore) rows(table, order string, model reflect.Type) (interface{}, error) {
+	elem := model
+	if model.Kind() == reflect.Pointer {
+		elem = model.Elem()
+	}
+	parsed, err := modelSchema(reflect.New(elem).Interface())
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+	stored := []reflect.Value{}
+	err = s.each(table, func(fields []*schema.Field, values []interface{}) error {
+		row := reflect.New(elem)
+		for i, field := range fields {
+			target, ok := parsed.FieldsByDBName[field.DBName]
+			if !ok {
+				return fmt.Errorf("%s has no column %q in %s", elem, field.DBName, table)
+			}
+			if values[i] == nil {
+				continue
+			}
+			if err := target.Set(ctx, row.Elem(), values[i]); err != nil {
+				return fmt.Errorf("%s.%s: %w", table, field.DBName, err)
+			}
+		}
+		stored = append(stored, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := [][]int{}
+	for _, column := range strings.Split(order, ",") {
+		field, ok := parsed.FieldsByDBName[strings.TrimSpace(column)]
+		if !ok {
+			return nil, fmt.Errorf("%s has no column %q", table, strings.TrimSpace(column))
+		}
+		indexes = append(indexes, field.StructField.Index)
+	}
+	sort.SliceStable(stored, func(i, j int) bool {
+		for _, index := range indexes {
+			if c := compareValues(stored[i].Elem().FieldByIndex(index), stored[j].Elem().FieldByIndex(index)); c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+
+	result := reflect.MakeSlice(reflect.SliceOf(model), 0, len(stored))
+	for _, row := range stored {
+		if model.Kind() == reflect.Pointer {
+			result = reflect.Append(result, row)
+		} else {
+			result = reflect.Append(result, row.Elem())
+		}
+	}
+	return result.Interface(), nil
+}
+
+// close removes the spooled rows.
+func (s *rowStore) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sp := range s.tables {
+		sp.file.Close()
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// compareValues orders the column values like the database, NULL last.
+func compareValues(a, b reflect.Value) int {
+	if a.Kind() == reflect.Pointer {
+		switch {
+		case a.IsNil() && b.IsNil():
+			return 0
+		case a.IsNil():
+			return 1
+		case b.IsNil():
+			return -1
+		}
+		return compareValues(a.Elem(), b.Elem())
+	}
+
+	switch a.Kind() {
+	case reflect.String:
+		return strings.Compare(a.String(), b.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return compareOrdered(a.Int(), b.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return compareOrdered(a.Uint(), b.Uint())
+	case reflect.Float32, reflect.Float64:
+		return compareOrdered(a.Float(), b.Float())
+	case reflect.Bool:
+		return compareOrdered(boolRank(a.Bool()), boolRank(b.Bool()))
+	}
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Compare(b.Interface().(time.Time))
+	}
+	return 0
+}
+
+func compareOrdered[T int64 | uint64 | float64 | int](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func boolRank(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
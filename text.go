@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"data-loader/models"
+)
+
+var (
+	corpusSize   = flag.Int("corpus-size", 20000, "texts sampled per language and kind from comments.json and the dataset captions and biographies to generate texts from")
+	templateRate = flag.Float64("template-rate", 0.3, "fraction of the generated comments, captions and bios made from a template instead of a corpus text")
+	hashtagRate  = flag.Float64("hashtag-rate", 0.3, "probability that a generated text gets hashtags from hash_tags")
+	mentionRate  = flag.Float64("mention-rate", 0.2, "probability that a generated text @mentions another user")
+)
+
+func validateText() error {
+	if err := validateRates(map[string]float64{"template-rate": *templateRate, "hashtag-rate": *hashtagRate, "mention-rate": *mentionRate}); err != nil {
+		return err
+	}
+	if *corpusSize < 0 {
+		return fmt.Errorf("invalid --corpus-size %d, expected 0 or more", *corpusSize)
+	}
+	return nil
+}
+
+type textKind int
+
+const (
+	commentText textKind = iota
+	captionText
+	bioText
+	textKinds
+)
+
+// defaultLanguage is the language of the users without a known country and of
+// comments.json.
+const defaultLanguage = "en"
+
+var countryLanguages = map[string]string{
+	"ES": "es", "MX": "es", "AR": "es", "CO": "es", "CL": "es", "PE": "es", "VE": "es", "EC": "es", "UY": "es",
+	"BR": "pt", "PT": "pt",
+	"FR": "fr", "BE": "fr", "SN": "fr", "CI": "fr",
+	"DE": "de", "AT": "de", "CH": "de",
+	"IT": "it",
+}
+
+// languageOf is the language of the texts of a user from country.
+func languageOf(country string) string {
+	if language, ok := countryLanguages[strings.ToUpper(country)]; ok {
+		return language
+	}
+	return defaultLanguage
+}
+
+// textTemplates are the texts of a language used when its corpus has none,
+// or for a --template-rate share of the texts. {emoji} is replaced with a
+// random emoji.
+var textTemplates = map[string][textKinds][]string{
+	"en": {
+		{"Love this {emoji}", "So good!", "This is amazing {emoji}", "Wow, great shot", "Need this in my life {emoji}", "Can't stop looking at this", "Beautiful {emoji}{emoji}", "Where is this?"},
+		{"Good times {emoji}", "Another day, another adventure", "Weekend mood {emoji}", "Throwback to this moment", "Making memories {emoji}", "New post, who dis"},
+		{"Living my best life {emoji}", "Coffee, travel and good vibes", "Just a human sharing moments {emoji}", "Creator | Dreamer | Explorer", "Follow for daily inspiration {emoji}"},
+	},
+	"es": {
+		{"Me encanta {emoji}", "¡Qué bonito!", "Increíble {emoji}", "¿Dónde es esto?", "Qué foto tan buena {emoji}", "Lo necesito {emoji}{emoji}"},
+		{"Buenos momentos {emoji}", "Fin de semana {emoji}", "Recuerdos que valen oro", "Otro día, otra aventura {emoji}"},
+		{"Viviendo la vida {emoji}", "Café, viajes y buena vibra", "Soñadora y creadora {emoji}", "Compartiendo momentos {emoji}"},
+	},
+	"pt": {
+		{"Amei {emoji}", "Que lindo!", "Incrível {emoji}", "Onde é isso?", "Que foto maravilhosa {emoji}", "Perfeito {emoji}{emoji}"},
+		{"Bons momentos {emoji}", "Clima de fim de semana {emoji}", "Memórias para sempre", "Mais um dia, mais uma aventura {emoji}"},
+		{"Vivendo intensamente {emoji}", "Café, viagens e boas vibrações", "Criador de conteúdo {emoji}", "Compartilhando momentos {emoji}"},
+	},
+	"fr": {
+		{"J'adore {emoji}", "Trop beau !", "Magnifique {emoji}", "C'est où ?", "Superbe photo {emoji}", "Incroyable {emoji}{emoji}"},
+		{"Les bons moments {emoji}", "Ambiance week-end {emoji}", "Souvenirs inoubliables", "Un jour, une aventure {emoji}"},
+		{"Je vis ma meilleure vie {emoji}", "Café, voyages et bonne humeur", "Créatrice de contenu {emoji}", "Partager les petits moments {emoji}"},
+	},
+	"de": {
+		{"Wunderschön {emoji}", "Richtig gut!", "Tolles Foto {emoji}", "Wo ist das?", "Einfach großartig {emoji}", "Mega {emoji}{emoji}"},
+		{"Gute Zeiten {emoji}", "Wochenendstimmung {emoji}", "Erinnerungen für immer", "Ein neuer Tag, ein neues Abenteuer {emoji}"},
+		{"Lebe mein bestes Leben {emoji}", "Kaffee, Reisen und gute Laune", "Kreativ und neugierig {emoji}", "Momente teilen {emoji}"},
+	},
+	"it": {
+		{"Che bello {emoji}", "Stupendo!", "Foto bellissima {emoji}", "Dove si trova?", "Meraviglioso {emoji}", "Top {emoji}{emoji}"},
+		{"Bei momenti {emoji}", "Atmosfera da weekend {emoji}", "Ricordi per sempre", "Un altro giorno, un'altra avventura {emoji}"},
+		{"Vivo la mia vita al meglio {emoji}", "Caffè, viaggi e buone vibrazioni", "Creativa e curiosa {emoji}", "Condivido momenti {emoji}"},
+	},
+}
+
+var emojis = []string{"😍", "🔥", "❤️", "👏", "😂", "🙌", "✨", "💯", "😊", "🌍", "📸", "☀️"}
+
+// textCorpus samples up to --corpus-size texts per language and kind, with a
+// reservoir so the sample is uniform over inputs of any size.
+type textCorpus struct {
+	rng   *rand.Rand
+	texts map[string]*[textKinds][]string
+	seen  map[string]*[textKinds]int
+}
+
+func newTextCorpus(rng *rand.Rand) *textCorpus {
+	return &textCorpus{rng: rng, texts: map[string]*[textKinds][]string{}, seen: map[string]*[textKinds]int{}}
+}
+
+func (c *textCorpus) add(language string, kind textKind, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+	if c.texts[language] == nil {
+		c.texts[language] = &[textKinds][]string{}
+		c.seen[language] = &[textKinds]int{}
+	}
+	texts, seen := c.texts[language], c.seen[language]
+	seen[kind]++
+	if len(texts[kind]) < *corpusSize {
+		texts[kind] = append(texts[kind], text)
+	} else if i := c.rng.Intn(seen[kind]); i < *corpusSize {
+		texts[kind][i] = text
+	}
+}
+
+// generate returns a text of kind in the language of country: a corpus text
+// or a template, with an @mention of one of mentions and #hashtags from tags
+// now and then.
+func (c *textCorpus) generate(rng *rand.Rand, kind textKind, country string, mentions, tags []string) string {
+	language := languageOf(country)
+	var texts []string
+	if c.texts[language] != nil {
+		texts = c.texts[language][kind]
+	}
+
+	var text string
+	if len(texts) > 0 && rng.Float64() >= *templateRate {
+		text = texts[rng.Intn(len(texts))]
+	} else {
+		templates := textTemplates[language][kind]
+		text = templates[rng.Intn(len(templates))]
+		for strings.Contains(text, "{emoji}") {
+			text = strings.Replace(text, "{emoji}", emojis[rng.Intn(len(emojis))], 1)
+		}
+	}
+
+	if len(mentions) > 0 && rng.Float64() < *mentionRate {
+		mention := "@" + mentions[rng.Intn(len(mentions))]
+		if kind == commentText {
+			text = mention + " " + text
+		} else {
+			text += " " + mention
+		}
+	}
+	if len(tags) > 0 && rng.Float64() < *hashtagRate {
+		used := map[string]bool{}
+		n := 1 + rng.Intn(3)
+		for tries := 0; len(used) < n && tries < 4*n; tries++ {
+			tag := strings.TrimPrefix(tags[rng.Intn(len(tags))], "#")
+			if !used[tag] {
+				used[tag] = true
+				text += " #" + tag
+			}
+		}
+	}
+	return text
+}
+
+// loadCommentCorpus samples the texts of comments.json, in the default
+// language. Without the file the comments come from the templates only.
+func loadCommentCorpus() (*textCorpus, error) {
+	corpus := newTextCorpus(stageRand(runSeed, "comment corpus"))
+	path := inputPath("comments")
+	err := forEachRecord(path, func(comment *models.Comment) error {
+		corpus.add(defaultLanguage, commentText, comment.CommentText)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s not found, generating the comments from templates", path)
+		return corpus, nil
+	}
+	return corpus, err
+}
+
+var (
+	datasetTextsOnce sync.Once
+	datasetTexts     *textCorpus
+	datasetUsernames []string
+	datasetTextsErr  error
+)
+
+// datasetCorpus samples the captions and biographies of the valid profiles by
+// the language of their country, for the texts of clones, and lists their
+// accounts for mentions.
+func datasetCorpus(path string) (*textCorpus, []string, error) {
+	datasetTextsOnce.Do(func() {
+		datasetTexts = newTextCorpus(stageRand(runSeed, "dataset corpus"))
+		datasetTextsErr = forEachValidProfile(path, func(data Data) error {
+			language := languageOf(data.CountryCode)
+			datasetTexts.add(language, bioText, data.Biography)
+			for _, post := range data.Posts {
+				datasetTexts.add(language, captionText, post.Caption)
+			}
+			datasetUsernames = append(datasetUsernames, data.Account)
+			return nil
+		})
+		sort.Strings(datasetUsernames)
+	})
+	return datasetTexts, datasetUsernames, datasetTextsErr
+}
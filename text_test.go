@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTextCorpusSample(t *testing.T) {
+	size := *corpusSize
+	*corpusSize = 5
+	t.Cleanup(func() { *corpusSize = size })
+
+	corpus := newTextCorpus(stageRand(1, "comment corpus"))
+	for i := 0; i < 100; i++ {
+		corpus.add("en", commentText, fmt.Sprintf(" comment %d ", i))
+	}
+	corpus.add("en", commentText, "   ")
+	corpus.add("es", captionText, "hola")
+
+	texts := corpus.texts["en"][commentText]
+	if len(texts) != 5 {
+		t.Fatalf("%d sampled comments, want 5", len(texts))
+	}
+	for _, text := range texts {
+		if !strings.HasPrefix(text, "comment ") || strings.TrimSpace(text) != text {
+			t.Errorf("sampled %q, want a trimmed comment", text)
+		}
+	}
+	if seen := corpus.seen["en"][commentText]; seen != 100 {
+		t.Errorf("seen %d comments, want 100 without the blank one", seen)
+	}
+	if got := corpus.texts["es"][captionText]; len(got) != 1 || got[0] != "hola" {
+		t.Errorf("spanish captions %v, want [hola]", got)
+	}
+}
+
+func TestGenerateText(t *testing.T) {
+	tests := []struct {
+		name         string
+		country      string
+		corpus       []string
+		templateRate float64
+		mentionRate  float64
+		hashtagRate  float64
+		want         func(text string) bool
+	}{
+		{
+			name:         "corpus text",
+			country:      "US",
+			corpus:       []string{"from the corpus"},
+			templateRate: 0,
+			want:         func(text string) bool { return text == "from the corpus" },
+		},
+		{
+			name:         "template without a corpus",
+			country:      "US",
+			templateRate: 0,
+			want:         func(text string) bool { return isTemplate("en", text) },
+		},
+		{
+			name:         "template of the language of the country",
+			country:      "mx",
+			corpus:       []string{"from the corpus"},
+			templateRate: 1,
+			want:         func(text string) bool { return isTemplate("es", text) },
+		},
+		{
+			name:        "mention first in a comment",
+			country:     "US",
+			corpus:      []string{"nice"},
+			mentionRate: 1,
+			want:        func(text string) bool { return text == "@bob nice" },
+		},
+		{
+			name:        "hashtags",
+			country:     "US",
+			corpus:      []string{"nice"},
+			hashtagRate: 1,
+			want: func(text string) bool {
+				tags := strings.Fields(strings.TrimPrefix(text, "nice"))
+				seen := map[string]bool{}
+				for _, tag := range tags {
+					if (tag != "#sunset" && tag != "#travel") || seen[tag] {
+						return false
+					}
+					seen[tag] = true
+				}
+				return strings.HasPrefix(text, "nice #") && len(tags) <= 3
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, mention, hashtag := *templateRate, *mentionRate, *hashtagRate
+			*templateRate, *mentionRate, *hashtagRate = tt.templateRate, tt.mentionRate, tt.hashtagRate
+			t.Cleanup(func() { *templateRate, *mentionRate, *hashtagRate = template, mention, hashtag })
+
+			corpus := newTextCorpus(stageRand(1, "comment corpus"))
+			for _, text := range tt.corpus {
+				corpus.add(languageOf(tt.country), commentText, text)
+			}
+			for seed := int64(1); seed <= 20; seed++ {
+				text := corpus.generate(stageRand(seed, "comments"), commentText, tt.country, []string{"bob"}, []string{"#sunset", "travel"})
+				if !tt.want(text) {
+					t.Errorf("seed %d: unexpected text %q", seed, text)
+				}
+			}
+		})
+	}
+}
+
+// isTemplate tells whether text is a comment template of language with its
+// emojis filled in.
+func isTemplate(language, text string) bool {
+	for _, template := range textTemplates[language][commentText] {
+		parts := strings.Split(template, "{emoji}")
+		rest := text
+		matches := strings.HasPrefix(rest, parts[0])
+		rest = strings.TrimPrefix(rest, parts[0])
+		for _, part := range parts[1:] {
+			if !matches {
+				break
+			}
+			matches = false
+			for _, emoji := range emojis {
+				if strings.HasPrefix(rest, emoji+part) {
+					rest, matches = strings.TrimPrefix(rest, emoji+part), true
+					break
+				}
+			}
+		}
+		if matches && rest == "" {
+			return true
+		}
+	}
+	return false
+}
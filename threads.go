@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+
+	"data-loader/models"
+)
+
+var (
+	topLevelRatio   = flag.Float64("top-level-ratio", 0.7, "fraction of the comments of a post that are not replies")
+	replyDepth      = flag.Int("reply-depth", 3, "maximum depth of a reply, 1 allows replies to top-level comments only, 0 disables replies")
+	replyFanout     = flag.Float64("reply-fanout", 0.5, "probability that a reply goes to a comment in proportion to the replies it already has instead of to any comment, higher values give fewer, longer threads")
+	authorReplyRate = flag.Float64("author-reply-rate", 0.2, "fraction of the replies written by the author of the post")
+)
+
+func validateThreading() error {
+	if err := validateRates(map[string]float64{"top-level-ratio": *topLevelRatio, "reply-fanout": *replyFanout, "author-reply-rate": *authorReplyRate}); err != nil {
+		return err
+	}
+	if *replyDepth < 0 {
+		return fmt.Errorf("invalid --reply-depth %d, expected 0 or more", *replyDepth)
+	}
+	return nil
+}
+
+// commentThread arranges the comments of a post, in id order, into threads.
+// The first comment and a --top-level-ratio share of the others are top-level
+// with a NULL parent, the rest reply to an earlier comment less than
+// --reply-depth deep. A top-level comment is written after the post, a reply
+// after its parent.
+type commentThread struct {
+	rng      *rand.Rand
+	post     models.Post
+	comments []*models.Comment
+	depth    []int
+	// open are the indexes of the comments that can take a reply, replied has
+	// an entry per reply received, for picking parents by their replies
+	open    []int
+	replied []int
+}
+
+func threadComments(rng *rand.Rand, post models.Post, comments []*models.Comment) {
+	t := &commentThread{rng: rng, post: post, comments: comments, depth: make([]int, len(comments))}
+	for i := range comments {
+		t.place(i)
+	}
+}
+
+func (t *commentThread) place(i int) {
+	comment := t.comments[i]
+	if len(t.open) == 0 || t.rng.Float64() < *topLevelRatio {
+		comment.ParentCommentID = nil
+		comment.CreatedAt = timeAfter(t.rng, t.post.CreatedAt, *activityWindow)
+		t.opened(i, 0)
+		return
+	}
+
+	parent := t.open[t.rng.Intn(len(t.open))]
+	if len(t.replied) > 0 && t.rng.Float64() < *replyFanout {
+		parent = t.replied[t.rng.Intn(len(t.replied))]
+	}
+	t.replied = append(t.replied, parent)
+
+	parentID := t.comments[parent].ID
+	comment.ParentCommentID = &parentID
+	comment.CreatedAt = timeAfter(t.rng, t.comments[parent].CreatedAt, *activityWindow)
+	if t.rng.Float64() < *authorReplyRate {
+		comment.UserID = t.post.UserID
+	}
+	t.opened(i, t.depth[parent]+1)
+}
+
+// opened records the depth of comment i, it can take replies when they are
+// not deeper than --reply-depth and it was made before the reference time, so
+// that there is time left for a reply after it.
+func (t *commentThread) opened(i, depth int) {
+	t.depth[i] = depth
+	if depth < *replyDepth && t.comments[i].CreatedAt.Before(clock()) {
+		t.open = append(t.open, i)
+	}
+}
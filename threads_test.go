@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"data-loader/models"
+)
+
+func TestThreadComments(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	setClock(&now)
+	t.Cleanup(func() { setClock(nil) })
+
+	tests := []struct {
+		name          string
+		topLevelRatio float64
+		replyDepth    int
+		replyFanout   float64
+		// posted is how long before the reference time the post was made
+		posted time.Duration
+	}{
+		{name: "defaults", topLevelRatio: 0.7, replyDepth: 3, replyFanout: 0.5, posted: 90 * 24 * time.Hour},
+		{name: "replies only", topLevelRatio: 0, replyDepth: 3, replyFanout: 0.5, posted: 90 * 24 * time.Hour},
+		{name: "one level", topLevelRatio: 0.2, replyDepth: 1, replyFanout: 1, posted: 90 * 24 * time.Hour},
+		{name: "deep and long", topLevelRatio: 0, replyDepth: 50, replyFanout: 1, posted: 90 * 24 * time.Hour},
+		{name: "no replies", topLevelRatio: 0, replyDepth: 0, replyFanout: 0.5, posted: 90 * 24 * time.Hour},
+		{name: "post made just before the reference time", topLevelRatio: 0, replyDepth: 3, replyFanout: 0.5, posted: time.Microsecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ratio, depth, fanout := *topLevelRatio, *replyDepth, *replyFanout
+			*topLevelRatio, *replyDepth, *replyFanout = tt.topLevelRatio, tt.replyDepth, tt.replyFanout
+			t.Cleanup(func() { *topLevelRatio, *replyDepth, *replyFanout = ratio, depth, fanout })
+
+			for seed := int64(1); seed <= 5; seed++ {
+				postID := int64(7)
+				post := models.Post{ID: &postID, UserID: "author", CreatedAt: now.Add(-tt.posted)}
+				comments := make([]*models.Comment, 200)
+				for i := range comments {
+					comments[i] = &models.Comment{ID: 1000 + int64(i), PostID: postID, UserID: fmt.Sprintf("user-%d", i)}
+				}
+				threadComments(stageRand(seed, "comments"), post, comments)
+				checkThread(t, seed, post, comments, tt.replyDepth)
+			}
+		})
+	}
+}
+
+// checkThread checks that every reply is to an earlier comment of the same
+// post, made after it and within --reply-depth, and that every comment is
+// made after the post and not after the reference time.
+func checkThread(t *testing.T, seed int64, post models.Post, comments []*models.Comment, replyDepth int) {
+	t.Helper()
+	index := map[int64]int{}
+	depth := make([]int, len(comments))
+	for i, comment := range comments {
+		index[comment.ID] = i
+		if comment.CreatedAt.Before(post.CreatedAt) || comment.CreatedAt.After(clock()) {
+			t.Fatalf("seed %d: comment %d made at %s, outside of %s and %s", seed, i, comment.CreatedAt, post.CreatedAt, clock())
+		}
+		if comment.ParentCommentID == nil {
+			continue
+		}
+		if i == 0 {
+			t.Fatalf("seed %d: the first comment is a reply", seed)
+		}
+		parent, ok := index[*comment.ParentCommentID]
+		if !ok {
+			t.Fatalf("seed %d: comment %d replies to %d, not an earlier comment of the post", seed, i, *comment.ParentCommentID)
+		}
+		if comments[parent].PostID != comment.PostID {
+			t.Fatalf("seed %d: comment %d replies to a comment of post %d", seed, i, comments[parent].PostID)
+		}
+		if !comment.CreatedAt.After(comments[parent].CreatedAt) {
+			t.Fatalf("seed %d: reply %d made at %s, not after its parent at %s", seed, i, comment.CreatedAt, comments[parent].CreatedAt)
+		}
+		depth[i] = depth[parent] + 1
+		if depth[i] > replyDepth {
+			t.Fatalf("seed %d: reply %d is %d deep, more than %d", seed, i, depth[i], replyDepth)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"flag"
+	"math/rand"
+	"time"
+)
+
+var (
+	storyWindow    = flag.Duration("story-window", 30*24*time.Hour, "stories are created within this duration before the reference time")
+	activityWindow = flag.Duration("activity-window", 30*24*time.Hour, "follows, comments, replies and likes happen within this duration after what they refer to")
+	accountAge     = flag.Duration("account-age", 2*365*24*time.Hour, "accounts without posts are created within this duration before the reference time")
+)
+
+// timeAfter draws a time after start, at most window later and never past the
+// reference time of the run.
+func timeAfter(rng *rand.Rand, start time.Time, window time.Duration) time.Time {
+	end := start.Add(window)
+	if now := clock(); end.After(now) {
+		end = now
+	}
+	if !end.After(start) {
+		return start
+	}
+	return start.Add(time.Duration(rng.Int63n(int64(end.Sub(start))) + 1))
+}
+
+// timeBefore draws a time at most window before end.
+func timeBefore(rng *rand.Rand, end time.Time, window time.Duration) time.Time {
+	if window <= 0 {
+		return end
+	}
+	return end.Add(-time.Duration(rng.Int63n(int64(window))))
+}
+
+// latest returns the later of a and b.
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// postedAt is the time of a post in the dataset, the reference time when the
+// dataset has none.
+func postedAt(post DataPost) time.Time {
+	if post.Datetime == 0 {
+		return clock()
+	}
+	return time.Unix(int64(post.Datetime), 0).UTC()
+}
+
+// joinedAt places the creation of an account before its first post.
+func joinedAt(rng *rand.Rand, data Data) time.Time {
+	if len(data.Posts) == 0 {
+		return timeBefore(rng, clock(), *accountAge)
+	}
+	first := postedAt(data.Posts[0])
+	for _, post := range data.Posts[1:] {
+		if posted := postedAt(post); posted.Before(first) {
+			first = posted
+		}
+	}
+	return timeBefore(rng, first, *activityWindow)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+var quarantineFile = flag.String("quarantine", "quarantine.jsonl", "JSON Lines file receiving the profile records that fail validation, with the reason")
+
+// instagramLaunch is the earliest Datetime a post can have.
+var instagramLaunch = time.Date(2010, time.October, 6, 0, 0, 0, 0, time.UTC)
+
+// rejection is one line of the quarantine file. An invalid profile is left out
+// as a whole, an invalid post, location or highlight only drops that record.
+type rejection struct {
+	Record  string      `json:"record"`
+	Account string      `json:"account"`
+	Reason  string      `json:"reason"`
+	Data    interface{} `json:"data"`
+}
+
+// profileValidator checks the records of one pass over a dataset. It
+// remembers the accounts and post urls it accepted, so every pass drops the
+// same duplicates.
+type profileValidator struct {
+	now      time.Time
+	accounts map[string]bool
+	urls     map[string]bool
+}
+
+func newProfileValidator() *profileValidator {
+	// posts after the reference time would get activity after it
+	return &profileValidator{now: clock(), accounts: map[string]bool{}, urls: map[string]bool{}}
+}
+
+// check returns data without its invalid posts and highlights, false when the
+// whole profile is invalid, and what was rejected.
+func (v *profileValidator) check(data Data) (Data, bool, []rejection) {
+	reject := func(record, reason string, value interface{}) rejection {
+		return rejection{Record: record, Account: data.Account, Reason: reason, Data: value}
+	}
+
+	if reason := v.profileProblem(data); reason != "" {
+		return data, false, []rejection{reject("profile", reason, data)}
+	}
+	v.accounts[data.Account] = true
+
+	var rejected []rejection
+	posts := make([]DataPost, 0, len(data.Posts))
+	for _, post := range data.Posts {
+		if post.Location != nil && post.Location.Name == "" {
+			rejected = append(rejected, reject("location", "location without a name", post))
+			continue
+		}
+		if reason := v.postProblem(post); reason != "" {
+			rejected = append(rejected, reject("post", reason, post))
+			continue
+		}
+		v.urls[post.Url] = true
+		posts = append(posts, post)
+	}
+	data.Posts = posts
+
+	highlights := make([]DataHighlight, 0, len(data.Highlights))
+	for _, highlight := range data.Highlights {
+		if reason := highlightProblem(highlight); reason != "" {
+			rejected = append(rejected, reject("highlight", reason, highlight))
+			continue
+		}
+		highlights = append(highlights, highlight)
+	}
+	data.Highlights = highlights
+
+	return data, true, rejected
+}
+
+func (v *profileValidator) profileProblem(data Data) string {
+	switch {
+	case data.Account == "":
+		return "account is empty"
+	case v.accounts[data.Account]:
+		return "duplicate account"
+	case data.Followers < 0 || data.Following < 0 || data.PostsCount < 0 || data.HighlightsCount < 0:
+		return "negative count"
+	case !validURL(data.ProfileImageLink):
+		return "invalid profile_image_link"
+	case !validURL(data.ExternalUrl):
+		return "invalid external_url"
+	}
+	if data.IsBusinessAccount && data.BusinessAddressJson.ZipCode != "" {
+		if _, err := strconv.Atoi(data.BusinessAddressJson.ZipCode); err != nil {
+			return "zip_code is not a number"
+		}
+	}
+	return ""
+}
+
+func (v *profileValidator) postProblem(post DataPost) string {
+	switch {
+	case post.Url == "":
+		return "url is empty"
+	case !validURL(post.Url):
+		return "invalid url"
+	case v.urls[post.Url]:
+		return "duplicate url"
+	case !validURL(post.ImageUrl):
+		return "invalid image_url"
+	case !validURL(post.VideoUrl):
+		return "invalid video_url"
+	case post.Likes < 0 || post.Comments < 0 || post.VideoViewCount < 0:
+		return "negative count"
+	}
+	if post.Datetime != 0 {
+		posted := time.Unix(int64(post.Datetime), 0)
+		if posted.Before(instagramLaunch) || posted.After(v.now) {
+			return "datetime out of range"
+		}
+	}
+	return ""
+}
+
+func highlightProblem(highlight DataHighlight) string {
+	switch {
+	case highlight.Title == "":
+		return "title is empty"
+	case !validURL(highlight.Image):
+		return "invalid image"
+	}
+	return ""
+}
+
+// validURL accepts empty values, optional fields are checked only when set.
+func validURL(value string) bool {
+	if value == "" {
+		return true
+	}
+	u, err := url.Parse(value)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// forEachValidProfile streams the dataset in path and calls fn with the valid
+// part of every profile.
+func forEachValidProfile(path string, fn func(Data) error) error {
+	validator := newProfileValidator()
+	return forEachRecord(path, func(data Data) error {
+		data, ok, _ := validator.check(data)
+		if !ok {
+			return nil
+		}
+		return fn(data)
+	})
+}
+
+// validationReport counts the records of a dataset and what was quarantined.
+type validationReport struct {
+	Profiles int
+	Rejected map[string]map[string]int
+}
+
+// validateDataset checks the dataset in path, writes the rejected records to
+// the quarantine file and reports the counts.
+func validateDataset(path, quarantinePath string) (*validationReport, error) {
+	out, err := os.Create(quarantinePath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	report := &validationReport{Rejected: map[string]map[string]int{}}
+	validator := newProfileValidator()
+	err = forEachRecord(path, func(data Data) error {
+		report.Profiles++
+		_, _, rejected := validator.check(data)
+		for _, r := range rejected {
+			if report.Rejected[r.Record] == nil {
+				report.Rejected[r.Record] = map[string]int{}
+			}
+			report.Rejected[r.Record][r.Reason]++
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+func (r *validationReport) total() int {
+	total := 0
+	for _, reasons := range r.Rejected {
+		for _, count := range reasons {
+			total += count
+		}
+	}
+	return total
+}
+
+func (r *validationReport) print(out io.Writer, quarantinePath string) error {
+	fmt.Fprintf(out, "validated %d profiles, %d records quarantined in %s\n", r.Profiles, r.total(), quarantinePath)
+	if r.total() == 0 {
+		return nil
+	}
+
+	records := make([]string, 0, len(r.Rejected))
+	for record := range r.Rejected {
+		records = append(records, record)
+	}
+	sort.Strings(records)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RECORD\tREASON\tCOUNT")
+	for _, record := range records {
+		reasons := make([]string, 0, len(r.Rejected[record]))
+		for reason := range r.Rejected[record] {
+			reasons = append(reasons, reason)
+		}
+		sort.Strings(reasons)
+		for _, reason := range reasons {
+			fmt.Fprintf(w, "%s\t%s\t%d\n", record, reason, r.Rejected[record][reason])
+		}
+	}
+	return w.Flush()
+}
+
+// checkDataset runs validateDataset and prints its report.
+func checkDataset(path string) error {
+	report, err := validateDataset(path, *quarantineFile)
+	if err != nil {
+		return fmt.Errorf("validating %s: %w", path, err)
+	}
+	return report.print(os.Stdout, *quarantineFile)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileValidatorReasons(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	valid := func() Data {
+		return Data{
+			Account:          "alice",
+			ProfileImageLink: "https://example.com/alice.jpg",
+			Posts: []DataPost{
+				{Url: "https://example.com/p/1", Datetime: int(now.Add(-time.Hour).Unix())},
+			},
+			Highlights: []DataHighlight{{Title: "Travel", Image: "https://example.com/h.jpg"}},
+		}
+	}
+	post := func(change func(*DataPost)) func(*Data) {
+		return func(data *Data) { change(&data.Posts[0]) }
+	}
+
+	tests := []struct {
+		name   string
+		seen   []string
+		urls   []string
+		change func(*Data)
+		// wantOK is whether the profile is kept, wantRejected the record and
+		// reason of every rejection
+		wantOK       bool
+		wantRejected []string
+	}{
+		{name: "valid", change: func(*Data) {}, wantOK: true},
+		{name: "empty account", change: func(d *Data) { d.Account = "" }, wantRejected: []string{"profile: account is empty"}},
+		{name: "duplicate account", seen: []string{"alice"}, change: func(*Data) {}, wantRejected: []string{"profile: duplicate account"}},
+		{name: "negative count", change: func(d *Data) { d.Followers = -1 }, wantRejected: []string{"profile: negative count"}},
+		{
+			name:         "invalid profile image",
+			change:       func(d *Data) { d.ProfileImageLink = "ftp://example.com/a.jpg" },
+			wantRejected: []string{"profile: invalid profile_image_link"},
+		},
+		{name: "invalid external url", change: func(d *Data) { d.ExternalUrl = "example.com" }, wantRejected: []string{"profile: invalid external_url"}},
+		{
+			name: "zip code",
+			change: func(d *Data) {
+				d.IsBusinessAccount = true
+				d.BusinessAddressJson.ZipCode = "AB1"
+			},
+			wantRejected: []string{"profile: zip_code is not a number"},
+		},
+		{
+			name:   "zip code of a personal account",
+			change: func(d *Data) { d.BusinessAddressJson.ZipCode = "AB1" },
+			wantOK: true,
+		},
+		{name: "post url empty", change: post(func(p *DataPost) { p.Url = "" }), wantOK: true, wantRejected: []string{"post: url is empty"}},
+		{name: "post url invalid", change: post(func(p *DataPost) { p.Url = "/p/1" }), wantOK: true, wantRejected: []string{"post: invalid url"}},
+		{
+			name:         "post url of an earlier post",
+			change:       func(d *Data) { d.Posts = append(d.Posts, d.Posts[0]) },
+			wantOK:       true,
+			wantRejected: []string{"post: duplicate url"},
+		},
+		{
+			name:         "post url of another profile",
+			urls:         []string{"https://example.com/p/1"},
+			change:       func(*Data) {},
+			wantOK:       true,
+			wantRejected: []string{"post: duplicate url"},
+		},
+		{name: "post image url", change: post(func(p *DataPost) { p.ImageUrl = "image" }), wantOK: true, wantRejected: []string{"post: invalid image_url"}},
+		{name: "post video url", change: post(func(p *DataPost) { p.VideoUrl = "video" }), wantOK: true, wantRejected: []string{"post: invalid video_url"}},
+		{name: "post negative count", change: post(func(p *DataPost) { p.Likes = -5 }), wantOK: true, wantRejected: []string{"post: negative count"}},
+		{
+			name:         "post before launch",
+			change:       post(func(p *DataPost) { p.Datetime = int(instagramLaunch.Add(-time.Second).Unix()) }),
+			wantOK:       true,
+			wantRejected: []string{"post: datetime out of range"},
+		},
+		{
+			name:         "post in the future",
+			change:       post(func(p *DataPost) { p.Datetime = int(now.Add(time.Second).Unix()) }),
+			wantOK:       true,
+			wantRejected: []string{"post: datetime out of range"},
+		},
+		{name: "post without datetime", change: post(func(p *DataPost) { p.Datetime = 0 }), wantOK: true},
+		{
+			name:         "location without a name",
+			change:       post(func(p *DataPost) { p.Location = &DataLocation{Slug: "somewhere"} }),
+			wantOK:       true,
+			wantRejected: []string{"location: location without a name"},
+		},
+		{
+			name:         "highlight title",
+			change:       func(d *Data) { d.Highlights[0].Title = "" },
+			wantOK:       true,
+			wantRejected: []string{"highlight: title is empty"},
+		},
+		{
+			name:         "highlight image",
+			change:       func(d *Data) { d.Highlights[0].Image = "h.jpg" },
+			wantOK:       true,
+			wantRejected: []string{"highlight: invalid image"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setClock(&now)
+			t.Cleanup(func() { setClock(nil) })
+			v := newProfileValidator()
+			for _, account := range tt.seen {
+				v.accounts[account] = true
+			}
+			for _, url := range tt.urls {
+				v.urls[url] = true
+			}
+			data := valid()
+			tt.change(&data)
+
+			checked, ok, rejected := v.check(data)
+			if ok != tt.wantOK {
+				t.Errorf("kept %v, want %v", ok, tt.wantOK)
+			}
+			got := []string{}
+			for _, r := range rejected {
+				got = append(got, r.Record+": "+r.Reason)
+				if r.Account != data.Account {
+					t.Errorf("rejection of account %q, want %q", r.Account, data.Account)
+				}
+			}
+			if strings.Join(got, "; ") != strings.Join(tt.wantRejected, "; ") {
+				t.Errorf("rejected %v, want %v", got, tt.wantRejected)
+			}
+			if ok && len(checked.Posts)+len(checked.Highlights)+len(rejected) != len(data.Posts)+len(data.Highlights) {
+				t.Errorf("kept %d posts and %d highlights after %d rejections", len(checked.Posts), len(checked.Highlights), len(rejected))
+			}
+		})
+	}
+}
+
+func TestProfileValidatorUsesSeededClock(t *testing.T) {
+	reference, err := resolveNow(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setClock(reference)
+	t.Cleanup(func() { setClock(nil) })
+
+	data := Data{Account: "alice", Posts: []DataPost{
+		{Url: "https://example.com/p/1", Datetime: int(seededNow.Add(-time.Hour).Unix())},
+		{Url: "https://example.com/p/2", Datetime: int(seededNow.Add(time.Hour).Unix())},
+	}}
+	checked, ok, rejected := newProfileValidator().check(data)
+	if !ok || len(checked.Posts) != 1 || checked.Posts[0].Url != "https://example.com/p/1" {
+		t.Fatalf("kept %v, %+v", ok, checked.Posts)
+	}
+	if len(rejected) != 1 || rejected[0].Reason != "datetime out of range" {
+		t.Fatalf("rejected %+v, want the post after the seeded reference time", rejected)
+	}
+}
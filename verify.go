@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// verifyCheck counts the rows of a table that break an invariant. fix, when
+// set, repairs them.
+type verifyCheck struct {
+	table string
+	name  string
+	count string
+	fix   string
+}
+
+// counter is a denormalized count of table that must match the rows of child
+// referencing it through column.
+type counter struct {
+	table, field, child, column string
+}
+
+var counters = []counter{
+	{"users", "following_count", "followers", "follower_id"},
+	{"users", "followers_count", "followers", "following_id"},
+	{"users", "posts_count", "posts", "user_id"},
+	{"users", "highlights_count", "highlights", "user_id"},
+	{"posts", "likes_count", "post_likes", "post_id"},
+	{"posts", "comments_count", "comments", "post_id"},
+}
+
+// reference is a column of table holding the id of a row of parent.
+type reference struct {
+	table, column, parent string
+}
+
+var references = []reference{
+	{"businesses", "user_id", "users"},
+	{"followers", "follower_id", "users"},
+	{"followers", "following_id", "users"},
+	{"followers_activity", "follower_id", "users"},
+	{"followers_activity", "following_id", "users"},
+	{"posts", "user_id", "users"},
+	{"posts", "location_id", "locations"},
+	{"posts", "sponsor_id", "users"},
+	{"post_images", "post_id", "posts"},
+	{"highlights", "user_id", "users"},
+	{"stories", "user_id", "users"},
+	{"story_views", "story_id", "stories"},
+	{"story_views", "viewer_id", "users"},
+	{"highlights_stories", "highlight_id", "highlights"},
+	{"highlights_stories", "story_id", "stories"},
+	{"highlights_story_activity", "highlight_id", "highlights"},
+	{"highlights_story_activity", "story_id", "stories"},
+	{"hash_tags", "created_by", "users"},
+	{"post_tags", "post_id", "posts"},
+	{"post_tags", "tag_id", "hash_tags"},
+	{"story_tags", "story_id", "stories"},
+	{"story_tags", "tag_id", "hash_tags"},
+	{"block", "user_id", "users"},
+	{"block", "blocked_id", "users"},
+	{"block_activity", "user_id", "users"},
+	{"block_activity", "blocked_id", "users"},
+	{"restrict", "user_id", "users"},
+	{"restrict", "restrict_user_id", "users"},
+	{"restrict_activity", "user_id", "users"},
+	{"restrict_activity", "restrict_user_id", "users"},
+	{"comments", "post_id", "posts"},
+	{"comments", "user_id", "users"},
+	{"comments", "parent_comment_id", "comments"},
+	{"post_mentions", "post_id", "posts"},
+	{"post_mentions", "mentioned_user_id", "users"},
+	{"comment_mentions", "comment_id", "comments"},
+	{"comment_mentions", "mentioned_user_id", "users"},
+	{"post_image_user_tags", "post_image_id", "post_images"},
+	{"post_image_user_tags", "user_id", "users"},
+	{"comment_likes", "comment_id", "comments"},
+	{"comment_likes", "liked_by", "users"},
+	{"comment_activity", "comment_id", "comments"},
+	{"comment_activity", "action_by", "users"},
+	{"conversations", "created_by", "users"},
+	{"messages", "conversation_id", "conversations"},
+	{"messages", "sender_id", "users"},
+	{"messages", "shared_post_id", "posts"},
+	{"conversation_participants", "conversation_id", "conversations"},
+	{"conversation_participants", "user_id", "users"},
+	{"conversation_participants", "last_read_message_id", "messages"},
+	{"message_reactions", "message_id", "messages"},
+	{"message_reactions", "user_id", "users"},
+	{"post_likes", "post_id", "posts"},
+	{"post_likes", "user_id", "users"},
+}
+
+func verifyChecks() []verifyCheck {
+	checks := []verifyCheck{}
+	for _, c := range counters {
+		actual := fmt.Sprintf("(SELECT count(*) FROM %s c WHERE c.%s = t.id)", quoteIdentifier(c.child), c.column)
+		checks = append(checks, verifyCheck{
+			table: c.table,
+			name:  fmt.Sprintf("%s matches %s", c.field, c.child),
+			count: fmt.Sprintf("SELECT count(*) FROM %s t WHERE t.%s IS DISTINCT FROM %s", quoteIdentifier(c.table), c.field, actual),
+			fix:   fmt.Sprintf("UPDATE %s t SET %s = %s WHERE t.%s IS DISTINCT FROM %s", quoteIdentifier(c.table), c.field, actual, c.field, actual),
+		})
+	}
+
+	for _, r := range references {
+		checks = append(checks, verifyCheck{
+			table: r.table,
+			name:  fmt.Sprintf("%s exists in %s", r.column, r.parent),
+			count: fmt.Sprintf("SELECT count(*) FROM %s c WHERE c.%s IS NOT NULL AND NOT EXISTS (SELECT 1 FROM %s p WHERE p.id = c.%s)",
+				quoteIdentifier(r.table), r.column, quoteIdentifier(r.parent), r.column),
+		})
+	}
+
+	return append(checks,
+		verifyCheck{
+			table: "followers",
+			name:  "no self-follows",
+			count: "SELECT count(*) FROM followers WHERE follower_id = following_id",
+		},
+		verifyCheck{
+			table: "comments",
+			name:  "parent comment is on the same post",
+			count: "SELECT count(*) FROM comments c JOIN comments p ON p.id = c.parent_comment_id WHERE p.post_id IS DISTINCT FROM c.post_id",
+		},
+	)
+}
+
+// verifyResult is the outcome of a check, fixed is the number of rows --fix
+// repaired.
+type verifyResult struct {
+	check      verifyCheck
+	violations int64
+	fixed      int64
+}
+
+func runVerify(args []string) error {
+	flags := newFlagSet("verify", "verify [--fix]")
+	fix := flags.Bool("fix", false, "repair the denormalized counters that do not match their tables")
+	flags.Parse(args)
+
+	if err := openDatabase(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	results := []verifyResult{}
+	problems := int64(0)
+	for _, check := range verifyChecks() {
+		result, err := runCheck(ctx, check, *fix)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", check.table, check.name, err)
+		}
+		results = append(results, result)
+		problems += result.violations
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TABLE\tCHECK\tROWS\tSTATUS")
+	for _, result := range results {
+		status := "ok"
+		switch {
+		case result.violations > 0:
+			status = "failed"
+		case result.fixed > 0:
+			status = "fixed"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", result.check.table, result.check.name, result.violations+result.fixed, status)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if problems > 0 {
+		if !*fix {
+			return fmt.Errorf("verify found %d rows breaking the checks, --fix repairs the counters", problems)
+		}
+		return fmt.Errorf("verify found %d rows breaking the checks", problems)
+	}
+	return nil
+}
+
+func runCheck(ctx context.Context, check verifyCheck, fix bool) (verifyResult, error) {
+	result := verifyResult{check: check}
+	if err := rawDB.QueryRowContext(ctx, check.count).Scan(&result.violations); err != nil {
+		return result, err
+	}
+	if !fix || check.fix == "" || result.violations == 0 {
+		return result, nil
+	}
+
+	updated, err := rawDB.ExecContext(ctx, check.fix)
+	if err != nil {
+		return result, err
+	}
+	result.fixed, err = updated.RowsAffected()
+	if err != nil {
+		return result, err
+	}
+	if err := rawDB.QueryRowContext(ctx, check.count).Scan(&result.violations); err != nil {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"data-loader/models"
+)
+
+// modelColumns maps the tables of the models to their columns.
+func modelColumns(t *testing.T) map[string]map[string]bool {
+	t.Helper()
+	tables := map[string]map[string]bool{}
+	for _, model := range []interface{}{
+		&models.User{}, &models.Business{}, &models.Follower{}, &models.FollowersActivity{}, &models.Location{},
+		&models.Post{}, &models.PostImage{}, &models.Highlight{}, &models.Story{}, &models.StoryView{},
+		&models.HighlightsStory{}, &models.HighlightsStoryActivity{}, &models.HashTag{}, &models.PostTag{},
+		&models.StoryTag{}, &models.PostMention{}, &models.CommentMention{}, &models.PostImageUserTag{},
+		&models.Block{}, &models.BlockActivity{}, &models.Restrict{}, &models.RestrictActivity{}, &models.Comment{},
+		&models.CommentLike{}, &models.CommentActivity{}, &models.PostLikes{}, &models.Conversation{},
+		&models.ConversationParticipant{}, &models.Message{}, &models.MessageReaction{},
+	} {
+		s, err := modelSchema(model)
+		if err != nil {
+			t.Fatal(err)
+		}
+		columns := map[string]bool{}
+		for _, name := range s.DBNames {
+			columns[name] = true
+		}
+		tables[s.Table] = columns
+	}
+	return tables
+}
+
+func TestVerifyChecksNameModelColumns(t *testing.T) {
+	tables := modelColumns(t)
+	has := func(table, column string) bool {
+		return tables[table][column]
+	}
+
+	for _, c := range counters {
+		if !has(c.table, c.field) || !has(c.table, "id") || !has(c.child, c.column) {
+			t.Errorf("counter %s.%s of %s.%s names a missing column", c.table, c.field, c.child, c.column)
+		}
+	}
+	for _, r := range references {
+		if !has(r.table, r.column) || !has(r.parent, "id") {
+			t.Errorf("reference %s.%s to %s names a missing column", r.table, r.column, r.parent)
+		}
+	}
+}
+
+func TestVerifyChecks(t *testing.T) {
+	checks := verifyChecks()
+	if want := len(counters) + len(references) + 2; len(checks) != want {
+		t.Fatalf("%d checks, want %d", len(checks), want)
+	}
+
+	names := map[string]bool{}
+	for i, check := range checks {
+		key := check.table + ": " + check.name
+		if names[key] {
+			t.Errorf("check %q is listed twice", key)
+		}
+		names[key] = true
+		if !strings.HasPrefix(check.count, "SELECT count(*) FROM ") {
+			t.Errorf("%s: count %q does not count rows", key, check.count)
+		}
+
+		// only the counters can be repaired, by setting them to the count
+		// the check compares them with
+		if i >= len(counters) {
+			if check.fix != "" {
+				t.Errorf("%s: has a fix, want none for a reference or invariant", key)
+			}
+			continue
+		}
+		c := counters[i]
+		if !strings.HasPrefix(check.fix, "UPDATE \""+c.table+"\" t SET "+c.field+" = ") || !strings.Contains(check.count, "FROM \""+c.child+"\" c WHERE c."+c.column+" = t.id") {
+			t.Errorf("%s: count %q and fix %q do not recount %s.%s", key, check.count, check.fix, c.child, c.column)
+		}
+	}
+}